@@ -0,0 +1,181 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The alias table registered with RegisterAliases, shared among all loads.
+var (
+	aliasTableMtx sync.RWMutex
+	aliasTable    = make(map[string]string)
+)
+
+// RegisterAliases registers legacy names for config variables, which helps
+// migrating services with different naming conventions onto gonfig.  The keys
+// of the table are the legacy names and the values the full IDs of the config
+// variables they are an alias of, like {"db_url": "database.url",
+// "LOGLEVEL": "log.level"}.  Every legacy name is consulted both as a config
+// file key, with the keys of nested objects joined by dots, and as the full
+// name of an environment variable, without Conf.EnvPrefix.  Values for the
+// config variable's own keys and environment variables take precedence, and a
+// warning is passed to Conf.WarnFunc when a legacy name is used.
+//
+// The table is shared by all loads.  Aliases of full IDs that are not config
+// variables of the loaded config struct are ignored, so that a single table
+// can serve multiple config structs.  Registering an alias again replaces it.
+func RegisterAliases(table map[string]string) {
+	aliasTableMtx.Lock()
+	defer aliasTableMtx.Unlock()
+
+	for alias, id := range table {
+		aliasTable[alias] = id
+	}
+}
+
+// tableAliases returns all aliases in the alias table, sorted, mapped to the
+// full IDs of the config variables they are an alias of.
+func tableAliases() ([]string, map[string]string) {
+	aliasTableMtx.RLock()
+	defer aliasTableMtx.RUnlock()
+
+	aliases := make([]string, 0, len(aliasTable))
+	table := make(map[string]string, len(aliasTable))
+	for alias, id := range aliasTable {
+		aliases = append(aliases, alias)
+		table[alias] = id
+	}
+	sort.Strings(aliases)
+	return aliases, table
+}
+
+// tableAliasesFor returns the aliases in the alias table for the full ID,
+// sorted.
+func tableAliasesFor(fullID string) []string {
+	aliases, table := tableAliases()
+	var result []string
+	for _, alias := range aliases {
+		if table[alias] == fullID {
+			result = append(result, alias)
+		}
+	}
+	return result
+}
+
+// applyAliasTable moves the values in the decoded config file of the keys that
+// are aliases in the alias table to the keys of the config variables they are
+// an alias of, unless those are set as well.
+func applyAliasTable(s *setup, m map[string]interface{}) {
+	aliases, table := tableAliases()
+	if len(aliases) == 0 {
+		return
+	}
+
+	known := make(map[string]bool, len(s.allOpts))
+	for _, opt := range s.allOpts {
+		known[opt.fullID()] = true
+	}
+
+	for _, alias := range aliases {
+		id := table[alias]
+		if !known[id] {
+			continue
+		}
+
+		parent, key, ok := mapPath(m, strings.Split(alias, "."), false)
+		if !ok {
+			continue
+		}
+		val, set := parent[key]
+		if !set {
+			continue
+		}
+
+		target, targetKey, ok := mapPath(m, strings.Split(id, "."), true)
+		if !ok {
+			continue
+		}
+		if _, set := target[targetKey]; set {
+			continue
+		}
+
+		target[targetKey] = val
+		deleteMapPath(m, strings.Split(alias, "."))
+		warn(s, "config key %s (from %s) is deprecated, use %s instead",
+			alias, SourceFile, id)
+	}
+}
+
+// mapPath returns the map holding the key at the path of keys of nested maps
+// and the last key of the path.  When create is set, missing nested maps are
+// created.
+func mapPath(m map[string]interface{}, path []string, create bool) (map[string]interface{}, string, bool) {
+	for _, key := range path[:len(path)-1] {
+		val, set := m[key]
+		if !set && create {
+			val = make(map[string]interface{})
+			m[key] = val
+		}
+		nested, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, "", false
+		}
+		m = nested
+	}
+	return m, path[len(path)-1], true
+}
+
+// deleteMapPath deletes the key at the path of keys of nested maps, and the
+// nested maps that are left empty, so that they are not reported as unknown
+// keys.
+func deleteMapPath(m map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(m, path[0])
+		return
+	}
+
+	nested, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		return
+	}
+	deleteMapPath(nested, path[1:])
+	if len(nested) == 0 {
+		delete(m, path[0])
+	}
+}
+
+// warn passes a warning to the warning function, if one is configured.
+func warn(s *setup, format string, args ...interface{}) {
+	if s.conf.WarnFunc != nil {
+		s.conf.WarnFunc(fmt.Sprintf(format, args...))
+	}
+}
+
+// aliasIDParts returns the full ID parts of the alias of the option.
+func aliasIDParts(opt *option, alias string) []string {
+	parts := make([]string, len(opt.fullIDParts))
+	copy(parts, opt.fullIDParts)
+	parts[len(parts)-1] = alias
+	return parts
+}
+
+// aliasFullID returns the full ID of the alias of the option.
+func aliasFullID(opt *option, alias string) string {
+	return strings.Join(aliasIDParts(opt, alias), ".")
+}
+
+// warnDeprecated warns that the deprecated option has been set by the source.
+func warnDeprecated(s *setup, opt *option, source Source) {
+	if opt.deprecated == "" {
+		return
+	}
+
+	warn(s, "config variable %s (from %s) is deprecated: %s",
+		opt.fullID(), source, opt.deprecated)
+}
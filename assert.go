@@ -0,0 +1,457 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// This file implements the tiny expression language used for the assert tag.
+//
+// The grammar is the following:
+//  or      = and { "||" and }
+//  and     = unary { "&&" unary }
+//  unary   = "!" unary | compare
+//  compare = primary [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) primary ]
+//  primary = "(" or ")" | number | string | "true" | "false" | identifier
+//
+// Strings are quoted with single or double quotes.  Identifiers refer to
+// options by their ID and are first looked up among the siblings of the
+// option carrying the tag and then by their full ID.
+
+// expr is a node in the syntax tree of an expression.
+// Evaluating an expression results in either a float64, a string or a bool.
+type expr interface {
+	eval() (interface{}, error)
+}
+
+// literalExpr is an expression with a constant value.
+type literalExpr struct {
+	value interface{}
+}
+
+func (e *literalExpr) eval() (interface{}, error) {
+	return e.value, nil
+}
+
+// optionExpr is an expression that evaluates to the value of an option.
+type optionExpr struct {
+	opt *option
+}
+
+func (e *optionExpr) eval() (interface{}, error) {
+	v := e.opt.value
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, fmt.Errorf("value of %s is not set", e.opt.fullID())
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	default:
+		panic("unsupported type in expression")
+	}
+}
+
+// notExpr is the logical negation of an expression.
+type notExpr struct {
+	x expr
+}
+
+func (e *notExpr) eval() (interface{}, error) {
+	x, err := evalBool(e.x)
+	if err != nil {
+		return nil, err
+	}
+	return !x, nil
+}
+
+// logicalExpr is a short-circuiting logical AND or OR of two expressions.
+type logicalExpr struct {
+	op   string
+	x, y expr
+}
+
+func (e *logicalExpr) eval() (interface{}, error) {
+	x, err := evalBool(e.x)
+	if err != nil {
+		return nil, err
+	}
+	if (e.op == "||" && x) || (e.op == "&&" && !x) {
+		return x, nil
+	}
+	return evalBool(e.y)
+}
+
+// compareExpr is a comparison between two expressions of the same type.
+type compareExpr struct {
+	op   string
+	x, y expr
+}
+
+func (e *compareExpr) eval() (interface{}, error) {
+	x, err := e.x.eval()
+	if err != nil {
+		return nil, err
+	}
+	y, err := e.y.eval()
+	if err != nil {
+		return nil, err
+	}
+
+	// cmp is -1, 0 or 1 for ordered types.
+	var cmp int
+	switch x := x.(type) {
+	case float64:
+		y, ok := y.(float64)
+		if !ok {
+			return nil, compareError(x, y)
+		}
+		if x < y {
+			cmp = -1
+		} else if x > y {
+			cmp = 1
+		}
+	case string:
+		y, ok := y.(string)
+		if !ok {
+			return nil, compareError(x, y)
+		}
+		cmp = strings.Compare(x, y)
+	case bool:
+		y, ok := y.(bool)
+		if !ok {
+			return nil, compareError(x, y)
+		}
+		switch e.op {
+		case "==":
+			return x == y, nil
+		case "!=":
+			return x != y, nil
+		default:
+			return nil, fmt.Errorf("operator %s not supported for booleans", e.op)
+		}
+	}
+
+	switch e.op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+		panic("unknown operator " + e.op)
+	}
+}
+
+// compareError returns an error indicating that x and y can not be compared.
+func compareError(x, y interface{}) error {
+	return fmt.Errorf("can not compare %v (%T) with %v (%T)", x, x, y, y)
+}
+
+// evalBool evaluates e and makes sure that the result is a boolean.
+func evalBool(e expr) (bool, error) {
+	v, err := e.eval()
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v (%T) is not a boolean", v, v)
+	}
+	return b, nil
+}
+
+// exprParser is a recursive descent parser for expressions.
+type exprParser struct {
+	tokens  []string
+	pos     int
+	resolve func(id string) (*option, error)
+}
+
+// tokenizeExpr splits the expression src in its tokens.
+func tokenizeExpr(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+
+		case strings.HasPrefix(src[i:], "||"), strings.HasPrefix(src[i:], "&&"),
+			strings.HasPrefix(src[i:], "=="), strings.HasPrefix(src[i:], "!="),
+			strings.HasPrefix(src[i:], "<="), strings.HasPrefix(src[i:], ">="):
+			tokens = append(tokens, src[i:i+2])
+			i += 2
+
+		case c == '<' || c == '>' || c == '!' || c == '(' || c == ')':
+			tokens = append(tokens, src[i:i+1])
+			i++
+
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, src[i:i+end+2])
+			i += end + 2
+
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(src) && (src[j] == '.' || (src[j] >= '0' && src[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			j := i + 1
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+
+		default:
+			return nil, fmt.Errorf("unexpected character '%c'", c)
+		}
+	}
+	return tokens, nil
+}
+
+// isIdentChar returns whether c can be part of an identifier.
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// parseExpr parses the expression src.  The resolve function is used to find
+// the options that identifiers refer to.
+func parseExpr(src string, resolve func(id string) (*option, error)) (expr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens, resolve: resolve}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token '%s'", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+// peek returns the next token without consuming it.
+func (p *exprParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// next consumes the next token.
+func (p *exprParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &logicalExpr{op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &logicalExpr{op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.peek() == "!" {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *exprParser) parseCompare() (expr, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		p.next()
+		y, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &compareExpr{op: op, x: x, y: y}, nil
+	}
+	return x, nil
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return nil, errors.New("unexpected end of expression")
+
+	case t == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return x, nil
+
+	case t == "true" || t == "false":
+		return &literalExpr{value: t == "true"}, nil
+
+	case t[0] == '\'' || t[0] == '"':
+		return &literalExpr{value: t[1 : len(t)-1]}, nil
+
+	case t[0] == '-' || t[0] == '.' || (t[0] >= '0' && t[0] <= '9'):
+		f, err := strconv.ParseFloat(t, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", t)
+		}
+		return &literalExpr{value: f}, nil
+
+	case isIdentChar(t[0]):
+		opt, err := p.resolve(t)
+		if err != nil {
+			return nil, err
+		}
+		return &optionExpr{opt: opt}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected token '%s'", t)
+	}
+}
+
+// isExprType returns whether values of type t can be used in expressions.
+func isExprType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// compileAssertions parses the assert tags of all options and resolves the
+// identifiers used in them.
+func compileAssertions(allOpts []*option) error {
+	byID := optionsByID(allOpts)
+
+	for _, opt := range allOpts {
+		if opt.assert == "" {
+			continue
+		}
+
+		opt := opt
+		resolve := func(id string) (*option, error) {
+			target, ok := lookupRelative(byID, opt, id)
+			if !ok {
+				return nil, fmt.Errorf("unknown config variable: %s", id)
+			}
+			if target.isParent || target.isSlice || !isExprType(target.value.Type()) {
+				return nil, fmt.Errorf(
+					"type of config variable %s (%s) can not be used in expressions",
+					id, target.value.Type())
+			}
+			return target, nil
+		}
+
+		var err error
+		opt.assertion, err = parseExpr(opt.assert, resolve)
+		if err != nil {
+			return fmt.Errorf("invalid assertion for %s: %s", opt.fullID(), err)
+		}
+	}
+
+	return nil
+}
+
+// checkAssertions evaluates the assertions of all options against the current
+// values of the options.
+func checkAssertions(s *setup) error {
+	for _, opt := range s.allOpts {
+		if opt.assertion == nil {
+			continue
+		}
+
+		ok, err := evalBool(opt.assertion)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate assertion '%s' for %s: %s",
+				opt.assert, opt.fullID(), err)
+		}
+		if !ok {
+			return fmt.Errorf("assertion '%s' for %s does not hold",
+				opt.assert, opt.fullID())
+		}
+	}
+
+	return nil
+}
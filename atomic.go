@@ -0,0 +1,41 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"reflect"
+)
+
+// atomicValue is implemented by fields that store their value atomically,
+// like Value.  The option of such a field writes to a detached value that is
+// stored in the field at the end of a successful load.
+type atomicValue interface {
+	// valueType returns the type of the stored value.
+	valueType() reflect.Type
+	// loadValue returns the stored value, if any.
+	loadValue() (reflect.Value, bool)
+	// storeValue stores the value.
+	storeValue(v reflect.Value)
+}
+
+var typeOfAtomicValue = reflect.TypeOf((*atomicValue)(nil)).Elem()
+
+// atomicField returns the atomicValue of the field value, if its type
+// implements it.
+func atomicField(value reflect.Value) (atomicValue, bool) {
+	if !value.CanAddr() || !value.Addr().Type().Implements(typeOfAtomicValue) {
+		return nil, false
+	}
+	return value.Addr().Interface().(atomicValue), true
+}
+
+// storeAtomics stores the values of all options of atomic fields.
+func storeAtomics(allOpts []*option) {
+	for _, opt := range allOpts {
+		if opt.atomic != nil {
+			opt.atomic.storeValue(opt.value)
+		}
+	}
+}
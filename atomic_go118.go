@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package gonfig
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// Value holds a config value that can be read and written concurrently, like
+// when the configuration is reloaded while it is being used.  Config struct
+// fields of type Value[T] are loaded like fields of type T, but their values
+// are only stored at the end of a successful load, so readers never observe a
+// partially loaded configuration for a single value.
+//
+// The zero Value is ready to use and holds the zero value of T.
+type Value[T any] struct {
+	v atomic.Value
+}
+
+// holder wraps the stored value, as atomic.Value does not store nil.
+type holder[T any] struct {
+	value T
+}
+
+// Get returns the current value.
+func (v *Value[T]) Get() T {
+	if h, ok := v.v.Load().(holder[T]); ok {
+		return h.value
+	}
+	var zero T
+	return zero
+}
+
+// Set replaces the current value.
+func (v *Value[T]) Set(value T) {
+	v.v.Store(holder[T]{value})
+}
+
+func (v *Value[T]) valueType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (v *Value[T]) loadValue() (reflect.Value, bool) {
+	h, ok := v.v.Load().(holder[T])
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(&h.value).Elem(), true
+}
+
+func (v *Value[T]) storeValue(value reflect.Value) {
+	v.Set(value.Interface().(T))
+}
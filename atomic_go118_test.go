@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package gonfig
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_AtomicValues(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Port  Value[int] `default:"80" max:"65535"`
+		Hosts Value[[]string]
+		Name  Value[string]
+	}
+
+	config := &Config{}
+	assert.Equal(t, 0, config.Port.Get())
+
+	setOS([]string{"--hosts", "a,b"}, nil)
+	require.NoError(t, Load(config, Conf{}))
+	assert.Equal(t, 80, config.Port.Get())
+	assert.Equal(t, []string{"a", "b"}, config.Hosts.Get())
+	assert.Equal(t, "", config.Name.Get())
+
+	// Reloading while the values are read concurrently.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				port := config.Port.Get()
+				assert.True(t, port == 80 || port == 8080)
+			}
+		}
+	}()
+	setOS(nil, map[string]string{"PORT": "8080", "NAME": "new"})
+	require.NoError(t, Load(config, Conf{}))
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, 8080, config.Port.Get())
+	assert.Equal(t, "new", config.Name.Get())
+	assert.Equal(t, []string{"a", "b"}, config.Hosts.Get())
+
+	// Failed loads leave the values untouched.
+	setOS(nil, map[string]string{"PORT": "99999", "NAME": "failed"})
+	require.Error(t, Load(config, Conf{}))
+	assert.Equal(t, 8080, config.Port.Get())
+	assert.Equal(t, "new", config.Name.Get())
+
+	// Values can be set through a config handle.
+	require.NoError(t, NewConfig(config).Set("port", "443"))
+	assert.Equal(t, 443, config.Port.Get())
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes that is parsed from a human-readable size,
+// like "512MiB" or "1.5GB", from all sources.  Decimal units (KB, MB, GB, TB
+// and PB) are multiples of 1000 and binary units (KiB, MiB, GiB, TiB and PiB)
+// are multiples of 1024.  Units are case-insensitive and a number without a
+// unit is a number of bytes.
+type ByteSize int64
+
+// The byte size units.
+const (
+	Byte ByteSize = 1
+
+	KB ByteSize = 1000 * Byte
+	MB ByteSize = 1000 * KB
+	GB ByteSize = 1000 * MB
+	TB ByteSize = 1000 * GB
+	PB ByteSize = 1000 * TB
+
+	KiB ByteSize = 1024 * Byte
+	MiB ByteSize = 1024 * KiB
+	GiB ByteSize = 1024 * MiB
+	TiB ByteSize = 1024 * GiB
+	PiB ByteSize = 1024 * TiB
+)
+
+var typeOfByteSize = reflect.TypeOf(ByteSize(0))
+
+// byteSizeUnits holds the units in the order in which they are preferred when
+// formatting a size.
+var byteSizeUnits = []struct {
+	name string
+	size ByteSize
+}{
+	{"PiB", PiB}, {"PB", PB},
+	{"TiB", TiB}, {"TB", TB},
+	{"GiB", GiB}, {"GB", GB},
+	{"MiB", MiB}, {"MB", MB},
+	{"KiB", KiB}, {"KB", KB},
+	{"B", Byte},
+}
+
+// ParseByteSize parses a human-readable size, like "512MiB", "10 MB" or
+// "1.5GiB".
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.TrimSpace(s)
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(str)
+	}
+	number, unitName := str[:i], strings.TrimSpace(str[i:])
+	if number == "" {
+		return 0, fmt.Errorf("invalid byte size '%s'", s)
+	}
+
+	unit := Byte
+	if unitName != "" {
+		found := false
+		for _, u := range byteSizeUnits {
+			if strings.EqualFold(unitName, u.name) {
+				unit, found = u.size, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown unit '%s' in byte size '%s'",
+				unitName, s)
+		}
+	}
+
+	if !strings.Contains(number, ".") {
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || n > math.MaxInt64/int64(unit) {
+			return 0, fmt.Errorf("invalid byte size '%s'", s)
+		}
+		return ByteSize(n) * unit, nil
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || f*float64(unit) >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid byte size '%s'", s)
+	}
+	return ByteSize(f * float64(unit)), nil
+}
+
+// String formats the size with the unit that represents it exactly with the
+// smallest number, like "512MiB" or "10MB".
+func (b ByteSize) String() string {
+	if b == 0 {
+		return "0B"
+	}
+
+	sign := ""
+	if b < 0 {
+		sign, b = "-", -b
+	}
+
+	best := byteSizeUnits[len(byteSizeUnits)-1]
+	for _, u := range byteSizeUnits {
+		if b%u.size == 0 && b/u.size < b/best.size {
+			best = u
+		}
+	}
+	return sign + strconv.FormatInt(int64(b/best.size), 10) + best.name
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	parsed, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for str, expected := range map[string]ByteSize{
+		"0":       0,
+		"42":      42,
+		"42B":     42,
+		"512MiB":  512 * MiB,
+		"10 MB":   10 * MB,
+		"1.5GiB":  3 * GiB / 2,
+		"2kib":    2 * KiB,
+		" 1TB ":   TB,
+		"8388608": 8 * MiB,
+	} {
+		size, err := ParseByteSize(str)
+		require.NoError(t, err, str)
+		assert.Equal(t, expected, size, str)
+	}
+
+	for _, str := range []string{"", "MiB", "12XB", "-1KB", "1.2.3MB",
+		"9999999PiB"} {
+		_, err := ParseByteSize(str)
+		assert.Error(t, err, str)
+	}
+}
+
+func TestByteSize_String(t *testing.T) {
+	assert.Equal(t, "0B", ByteSize(0).String())
+	assert.Equal(t, "42B", ByteSize(42).String())
+	assert.Equal(t, "512MiB", (512 * MiB).String())
+	assert.Equal(t, "10MB", (10 * MB).String())
+	assert.Equal(t, "2000KiB", (2048 * KB).String())
+	assert.Equal(t, "1536MiB", (3 * GiB / 2).String())
+	assert.Equal(t, "-1KiB", (-KiB).String())
+}
+
+func TestLoad_ByteSize(t *testing.T) {
+	requireFlags(t)
+
+	setOS([]string{"--limit", "1GiB"}, map[string]string{"BUFFER": "64KiB"})
+	config := &struct {
+		Limit  ByteSize
+		Buffer ByteSize
+		Cache  ByteSize `default:"512MB"`
+		File   ByteSize
+		Sizes  []ByteSize
+	}{}
+	require.NoError(t, LoadWithRawFile(config,
+		[]byte(`{"file": "10MB", "sizes": ["1KiB", 2048]}`),
+		Conf{FileDecoder: DecoderJSON}))
+
+	assert.Equal(t, GiB, config.Limit)
+	assert.Equal(t, 64*KiB, config.Buffer)
+	assert.Equal(t, 512*MB, config.Cache)
+	assert.Equal(t, 10*MB, config.File)
+	assert.Equal(t, []ByteSize{KiB, 2 * KiB}, config.Sizes)
+
+	setOS([]string{"--limit", "1XB"}, nil)
+	err := Load(config, Conf{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown unit 'XB'")
+}
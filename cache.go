@@ -0,0 +1,126 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"reflect"
+	"sync"
+)
+
+// structureCache holds the options of the config struct types that were
+// inspected before, so that loading the same type again, like for every
+// tenant of a service or in tests, does not have to parse the tags and
+// perform the sanity checks again.
+var structureCache sync.Map // map[structureKey]*structure
+
+// structureKey is the key of a config struct type in the structureCache.
+type structureKey struct {
+	typ     reflect.Type
+	section string
+}
+
+// structure is the cached result of inspecting a config struct type.  Its
+// options are bound to a zero value of the type that is never loaded, so they
+// are only used as a template.
+type structure struct {
+	opts    []*option
+	allOpts []*option
+}
+
+// inspectCachedStructure inspects the config struct c like
+// inspectConfigStructure, using the cached template for its type if there is
+// one.  Errors are not cached, as they are not expected at runtime.
+func inspectCachedStructure(s *setup, c interface{}) error {
+	key := structureKey{reflect.TypeOf(c), s.section}
+	cached, ok := structureCache.Load(key)
+	if !ok {
+		tmpl := &setup{section: s.section}
+		zero := reflect.New(key.typ.Elem()).Interface()
+		if err := buildConfigStructure(tmpl, zero); err != nil {
+			return err
+		}
+
+		cached, _ = structureCache.LoadOrStore(key, &structure{
+			opts:    tmpl.opts,
+			allOpts: tmpl.allOpts,
+		})
+	}
+
+	return cached.(*structure).bind(s, c)
+}
+
+// bind sets the options of the setup to copies of the options of the
+// template that refer to the fields of the config struct c.
+func (st *structure) bind(s *setup, c interface{}) error {
+	v := reflect.ValueOf(c).Elem()
+	copies := make(map[*option]*option, len(st.allOpts))
+
+	s.opts = make([]*option, len(st.opts))
+	for i, opt := range st.opts {
+		s.opts[i] = opt.bind(v, copies)
+	}
+	s.allOpts = make([]*option, len(st.allOpts))
+	for i, opt := range st.allOpts {
+		s.allOpts[i] = copies[opt]
+	}
+
+	for _, opt := range s.allOpts {
+		if opt.fallbackOpt != nil {
+			opt.fallbackOpt = copies[opt.fallbackOpt]
+		}
+	}
+
+	// The assertions refer to the options they use, so they are compiled
+	// again for the copies.
+	if err := compileAssertions(s.allOpts); err != nil {
+		return err
+	}
+
+	if defaulter, ok := c.(Defaulter); ok {
+		s.defaulter = defaulter
+	}
+	return nil
+}
+
+// bind returns a copy of the template option, and of its sub-options, that
+// refers to the field of the struct value parent.  The synthetic parents of a
+// section have no field, their sub-options refer to parent itself.  The
+// options of the elements of lists of structs are shared, as they are not
+// bound to a value.
+func (o *option) bind(parent reflect.Value, copies map[*option]*option) *option {
+	opt := new(option)
+	*opt = *o
+	copies[o] = opt
+
+	v := parent
+	if o.value.IsValid() {
+		field := parent.Field(o.index)
+		opt.value = field
+		if o.atomic != nil {
+			// See createOptionsFromStruct.
+			opt.atomic, _ = atomicField(field)
+			opt.value = reflect.New(opt.atomic.valueType()).Elem()
+			if current, ok := opt.atomic.loadValue(); ok {
+				opt.value.Set(current)
+			}
+		}
+		if opt.value.Kind() == reflect.Ptr && !opt.isPointer && opt.value.IsNil() {
+			opt.value.Set(reflect.New(opt.value.Type().Elem()))
+		}
+
+		v = opt.value
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+	}
+
+	if o.subOpts != nil {
+		opt.subOpts = make([]*option, len(o.subOpts))
+		for i, sub := range o.subOpts {
+			opt.subOpts[i] = sub.bind(v, copies)
+		}
+	}
+	return opt
+}
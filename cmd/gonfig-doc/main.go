@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Command gonfig-doc generates the descriptions of config variables from the
+// doc comments of the fields of gonfig config structs.
+//
+// Usage:
+//
+//	gonfig-doc [flags] config.go
+//
+// For every struct type in the Go source file, it generates a
+// gonfig.FieldDescriber implementation that returns the doc comments of the
+// fields.  They are used as the descriptions of the config variables that do
+// not have a desc tag.  It is meant to be invoked in a go:generate directive:
+//
+//	//go:generate gonfig-doc -o config_desc.go $GOFILE
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/stevenroose/gonfig"
+)
+
+var config = struct {
+	Output string   `short:"o" desc:"the file to write the generated code to; stdout if empty"`
+	Types  []string `short:"t" desc:"the struct types to generate descriptions for; all if empty"`
+}{}
+
+func run() error {
+	var args []string
+	err := gonfig.Load(&config, gonfig.Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		ArgsOut:     &args,
+		HelpMessage: "Usage: gonfig-doc [flags] <Go source file>",
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one Go source file, got %d",
+			len(args))
+	}
+
+	src, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	generated, err := gonfig.GenerateDescriptions(src, config.Types)
+	if err != nil {
+		return err
+	}
+
+	if config.Output == "" {
+		_, err = os.Stdout.Write(generated)
+		return err
+	}
+	return ioutil.WriteFile(config.Output, generated, 0644)
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "gonfig-doc: %s\n", err)
+		os.Exit(1)
+	}
+}
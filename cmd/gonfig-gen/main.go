@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+// Command gonfig-gen generates a gonfig config struct from a sample YAML, TOML
+// or JSON config file.
+//
+// Usage:
+//
+//	gonfig-gen [flags] config.yaml
+//
+// The types of the fields are inferred from the values in the sample file,
+// which are also used as default values.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stevenroose/gonfig"
+)
+
+var config = struct {
+	Output  string `short:"o" desc:"the file to write the generated code to; stdout if empty"`
+	Package string `short:"p" default:"main" desc:"the package of the generated code"`
+	Type    string `short:"t" default:"Config" desc:"the name of the generated struct type"`
+}{}
+
+// decoderFor returns the decoder for the file based on its extension.
+func decoderFor(filename string) gonfig.FileDecoderFn {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return gonfig.DecoderJSON
+	case ".toml":
+		return gonfig.DecoderTOML
+	case ".yaml", ".yml":
+		return gonfig.DecoderYAML
+	default:
+		return nil
+	}
+}
+
+func run() error {
+	var args []string
+	err := gonfig.Load(&config, gonfig.Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		ArgsOut:     &args,
+		HelpMessage: "Usage: gonfig-gen [flags] <sample config file>",
+	})
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one sample config file, got %d",
+			len(args))
+	}
+
+	content, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	src, err := gonfig.GenerateStruct(content, decoderFor(args[0]),
+		config.Package, config.Type)
+	if err != nil {
+		return err
+	}
+
+	if config.Output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(config.Output, src, 0644)
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "gonfig-gen: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !gonfig_noflags
+// +build !gonfig_noflags
+
+package gonfig
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// completionFlag holds the information about a flag needed to generate
+// completion scripts.
+type completionFlag struct {
+	name    string
+	short   string
+	desc    string
+	hasArg  bool
+	choices []string
+}
+
+// completionFlags returns the completion information for all flags in the
+// flag set, including the built-in ones.
+func completionFlags(s *setup) []completionFlag {
+	byID := make(map[string]*option)
+	for _, opt := range s.allOpts {
+		byID[opt.fullID()] = opt
+	}
+
+	var flags []completionFlag
+	createFlagSet(s).VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			// Deprecated flags and aliases are not offered.
+			return
+		}
+
+		flag := completionFlag{
+			name:   f.Name,
+			short:  f.Shorthand,
+			desc:   f.Usage,
+			hasArg: f.NoOptDefVal == "",
+		}
+		if opt, ok := byID[f.Name]; ok {
+			// The flag usage lists the choices, which are completed anyway.
+			described := *opt
+			if opt.secret {
+				described.defaul = ""
+			}
+			flag.desc = expandDesc(s, &described)
+			flag.choices = opt.oneof
+		}
+		flags = append(flags, flag)
+	})
+	return flags
+}
+
+// shellQuote quotes s to be used as a single quoted shell word.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// writeBashCompletion writes a bash completion script for the flags.
+func writeBashCompletion(w *bytes.Buffer, prog string, flags []completionFlag) {
+	fn := "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, prog) + "_completion"
+
+	var words []string
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(w, "    local prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(w, "    case \"$prev\" in\n")
+	for _, f := range flags {
+		words = append(words, "--"+f.name)
+		if f.short != "" {
+			words = append(words, "-"+f.short)
+		}
+		if len(f.choices) == 0 {
+			continue
+		}
+
+		pattern := "--" + f.name
+		if f.short != "" {
+			pattern += "|-" + f.short
+		}
+		fmt.Fprintf(w, "        %s)\n", pattern)
+		fmt.Fprintf(w, "            COMPREPLY=($(compgen -W %s -- \"$cur\"))\n",
+			shellQuote(strings.Join(f.choices, " ")))
+		fmt.Fprintf(w, "            return 0\n")
+		fmt.Fprintf(w, "            ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W %s -- \"$cur\"))\n",
+		shellQuote(strings.Join(words, " ")))
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -F %s %s\n", fn, prog)
+}
+
+// writeZshCompletion writes a zsh completion script for the flags.
+func writeZshCompletion(w *bytes.Buffer, prog string, flags []completionFlag) {
+	escapeDesc := strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`)
+
+	fmt.Fprintf(w, "#compdef %s\n\n", prog)
+	fmt.Fprintf(w, "_arguments")
+	for _, f := range flags {
+		spec := "[" + escapeDesc.Replace(f.desc) + "]"
+		if f.hasArg {
+			spec += ":" + f.name + ":"
+			if len(f.choices) > 0 {
+				spec += "(" + strings.Join(f.choices, " ") + ")"
+			}
+		}
+
+		if f.short != "" {
+			fmt.Fprintf(w, " \\\n    %s{-%s,--%s}%s",
+				shellQuote("(-"+f.short+" --"+f.name+")"), f.short, f.name,
+				shellQuote(spec))
+		} else {
+			fmt.Fprintf(w, " \\\n    %s", shellQuote("--"+f.name+spec))
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// writeFishCompletion writes a fish completion script for the flags.
+func writeFishCompletion(w *bytes.Buffer, prog string, flags []completionFlag) {
+	for _, f := range flags {
+		fmt.Fprintf(w, "complete -c %s -l %s", prog, f.name)
+		if f.short != "" {
+			fmt.Fprintf(w, " -s %s", f.short)
+		}
+		if f.desc != "" {
+			fmt.Fprintf(w, " -d %s", shellQuote(f.desc))
+		}
+		if len(f.choices) > 0 {
+			fmt.Fprintf(w, " -x -a %s", shellQuote(strings.Join(f.choices, " ")))
+		} else if f.hasArg {
+			fmt.Fprintf(w, " -r")
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// GenerateCompletion writes a shell completion script for the command line
+// flags of the config struct at c to w.  The supported shells are "bash",
+// "zsh" and "fish".  The values allowed by the oneof tag are offered as
+// completions for the value of the corresponding flags.
+// Use conf to specify the same behavior as for Load, as it determines which
+// built-in flags are available.
+//
+// This method panics if there is a problem with the configuration struct, in
+// the same way Load does.
+func GenerateCompletion(c interface{}, conf Conf, shell string, w io.Writer) error {
+	s := &setup{
+		conf: &conf,
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		panic(fmt.Errorf("error in config structure: %s", err))
+	}
+
+	if err := checkDefaults(setDefaults(s)); err != nil {
+		return err
+	}
+
+	if err := checkFlagConflicts(s); err != nil {
+		return err
+	}
+
+	prog := path.Base(os.Args[0])
+	flags := completionFlags(s)
+
+	var buf bytes.Buffer
+	switch shell {
+	case "bash":
+		writeBashCompletion(&buf, prog, flags)
+	case "zsh":
+		writeZshCompletion(&buf, prog, flags)
+	case "fish":
+		writeFishCompletion(&buf, prog, flags)
+	default:
+		return fmt.Errorf("unsupported shell for completion: %s", shell)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
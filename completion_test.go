@@ -0,0 +1,75 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type completionTestStruct struct {
+	Level   string `short:"l" oneof:"debug,info" desc:"the log level"`
+	Verbose bool   `desc:"be verbose"`
+	Nested  struct {
+		Port int `desc:"the [port]"`
+	}
+}
+
+func TestGenerateCompletion(t *testing.T) {
+	requireFlags(t)
+
+	testCases := []struct {
+		shell    string
+		expected []string
+	}{
+		{
+			"bash",
+			[]string{
+				"--level|-l)",
+				"compgen -W 'debug info'",
+				"'--level -l --verbose --nested.port --help -h'",
+				"complete -F _test_completion test",
+			},
+		},
+		{
+			"zsh",
+			[]string{
+				"#compdef test",
+				"'(-l --level)'{-l,--level}'[the log level]:level:(debug info)'",
+				"'--verbose[be verbose]'",
+				`'--nested.port[the \[port\]]:nested.port:'`,
+			},
+		},
+		{
+			"fish",
+			[]string{
+				"complete -c test -l level -s l -d 'the log level' -x -a 'debug info'",
+				"complete -c test -l verbose -d 'be verbose'\n",
+				"complete -c test -l nested.port -d 'the [port]' -r",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.shell, func(t *testing.T) {
+			setOS(nil, nil)
+			var buf bytes.Buffer
+			require.NoError(t, GenerateCompletion(
+				&completionTestStruct{}, Conf{}, tc.shell, &buf))
+
+			for _, expected := range tc.expected {
+				assert.Contains(t, buf.String(), expected)
+			}
+		})
+	}
+}
+
+func TestGenerateCompletion_UnknownShell(t *testing.T) {
+	assert.Error(t, GenerateCompletion(
+		&completionTestStruct{}, Conf{}, "powershell", &bytes.Buffer{}))
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Config is a handle to a config struct that provides access to its options by
+// their full ID, this is the IDs of the option and all its parents joined by
+// dots, like "server.port".
+//
+// When created with Instrument, the handle records which options are read
+// through it, so that options that are never used by the application can be
+// detected.  Reads that access the struct fields directly are not recorded.
+type Config struct {
+	mu sync.Mutex
+
+	opts    map[string]*option // All options by their full ID.
+	order   []string           // The full IDs of all options in struct order.
+	tracked bool               // Whether reads are being recorded.
+	reads   map[string]int     // The number of reads per full ID.
+}
+
+// newConfig creates a new config handle for the options in the setup.
+func newConfig(s *setup) *Config {
+	c := &Config{
+		opts:  make(map[string]*option),
+		reads: make(map[string]int),
+	}
+	for _, opt := range s.allOpts {
+		c.opts[opt.fullID()] = opt
+		c.order = append(c.order, opt.fullID())
+	}
+	return c
+}
+
+// NewConfig creates a config handle for the config struct at c.  The struct is
+// typically already loaded using Load.
+//
+// This method panics if there is a problem with the configuration struct, in
+// the same way Load does.
+func NewConfig(c interface{}) *Config {
+	s := &setup{
+		conf: &Conf{},
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		panic(fmt.Errorf("error in config structure: %s", err))
+	}
+
+	return newConfig(s)
+}
+
+// LoadConfig loads the configuration in the struct at c like Load does and
+// returns a config handle for it.  The handle knows which options have been
+// set by a source, see WasSet.
+func LoadConfig(c interface{}, conf Conf) (*Config, error) {
+	s := newSetup(context.Background(), &conf, c)
+	if err := load(s); err != nil {
+		return nil, err
+	}
+
+	return newConfig(s), nil
+}
+
+// Instrument creates a config handle for the config struct at c that records
+// every read of an option performed through Get.  The struct is typically
+// already loaded using Load.  Use Unread to list the options that have not
+// been read.
+//
+// This method panics if there is a problem with the configuration struct, in
+// the same way Load does.
+func Instrument(c interface{}) *Config {
+	config := NewConfig(c)
+	config.tracked = true
+	return config
+}
+
+// Get returns the current value of the option with the given full ID.  The
+// second return value is false if no such option exists.
+// Reading a nested option marks all its children as read as well.
+func (c *Config) Get(id string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	opt, ok := c.opts[id]
+	if !ok {
+		return nil, false
+	}
+
+	if c.tracked {
+		c.markRead(opt)
+	}
+
+	return opt.value.Interface(), true
+}
+
+// Set sets the value of the option with the given full ID by parsing the
+// string value in the same way values from environment variables are parsed.
+// The normalizers and validation tags of the option are applied as well.
+//
+// Get and Set are safe for concurrent use, but reading or writing the fields of
+// the config struct directly while calling Set is not.
+func (c *Config) Set(id string, value string) error {
+	opt, ok := c.opts[id]
+	if !ok {
+		return fmt.Errorf("unknown config variable: %s", id)
+	}
+	if opt.isParent {
+		return fmt.Errorf("can not set nested config variable %s", id)
+	}
+
+	// Parse the value using a detached copy of the option.
+	converted := *opt
+	converted.value = reflect.New(opt.value.Type()).Elem()
+	if err := converted.setValueByString(value); err != nil {
+		return fmt.Errorf("invalid value for %s: %s", id, err)
+	}
+	normalize(&converted)
+	if err := validate(&converted); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	opt.value.Set(converted.value)
+	if opt.atomic != nil {
+		opt.atomic.storeValue(opt.value)
+	}
+	return nil
+}
+
+// WasSet returns whether the option with the given full ID has been set
+// explicitly by any source when loading the configuration, as opposed to
+// being left at its default value.  This allows behavior like picking a free
+// port only when the user did not set one.  Options whose value is taken from
+// their fallback are set when their fallback is.  Nested options are set when
+// any of their children is.
+//
+// WasSet always returns false for handles that have not been created with
+// LoadConfig.  Changes made through Set are not taken into account.
+func (c *Config) WasSet(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	opt, ok := c.opts[id]
+	return ok && wasSet(opt)
+}
+
+// wasSet returns whether the option or any of its sub-options has been set
+// by a source.
+func wasSet(opt *option) bool {
+	if opt.source != "" {
+		return true
+	}
+	for _, sub := range opt.subOpts {
+		if wasSet(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// overridesKey is the context key for the overrides of a config handle.
+type overridesKey struct {
+	c *Config
+}
+
+// overrides returns the overrides for this handle stored in the context.
+func (c *Config) overrides(ctx context.Context) map[string]interface{} {
+	overrides, _ := ctx.Value(overridesKey{c}).(map[string]interface{})
+	return overrides
+}
+
+// WithOverrides returns a copy of the context that carries temporary values for
+// the given options, which are identified by their full ID.  The overrides
+// only apply to GetContext and Snapshot calls on this handle using the returned
+// context or a context derived from it; the config struct itself is never
+// modified, so the overrides are reverted automatically when the context is
+// discarded.  Overrides can be nested, in which case inner ones take
+// precedence.
+//
+// Values are converted to the type of the option in the same way values from
+// config files are.
+func (c *Config) WithOverrides(ctx context.Context, overrides map[string]interface{}) (context.Context, error) {
+	merged := make(map[string]interface{})
+	for id, val := range c.overrides(ctx) {
+		merged[id] = val
+	}
+
+	for id, val := range overrides {
+		opt, ok := c.opts[id]
+		if !ok {
+			return nil, fmt.Errorf("unknown config variable: %s", id)
+		}
+		if opt.isParent {
+			return nil, fmt.Errorf(
+				"can not override nested config variable %s", id)
+		}
+
+		// Convert the value using a detached copy of the option.
+		converted := *opt
+		converted.value = reflect.New(opt.value.Type()).Elem()
+		if err := converted.setValue(reflect.ValueOf(val)); err != nil {
+			return nil, fmt.Errorf("invalid override for %s: %s", id, err)
+		}
+		merged[id] = converted.value.Interface()
+	}
+
+	return context.WithValue(ctx, overridesKey{c}, merged), nil
+}
+
+// GetContext returns the value of the option with the given full ID, taking
+// into account the overrides carried by the context.  The second return value
+// is false if no such option exists.
+// Nested options always return the value in the config struct.
+func (c *Config) GetContext(ctx context.Context, id string) (interface{}, bool) {
+	if val, ok := c.overrides(ctx)[id]; ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.tracked {
+			c.markRead(c.opts[id])
+		}
+		return val, true
+	}
+
+	return c.Get(id)
+}
+
+// Snapshot returns the values of all non-nested options by their full ID,
+// taking into account the overrides carried by the context.
+func (c *Config) Snapshot(ctx context.Context) map[string]interface{} {
+	overrides := c.overrides(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := make(map[string]interface{})
+	for id, opt := range c.opts {
+		if opt.isParent {
+			continue
+		}
+		if val, ok := overrides[id]; ok {
+			snapshot[id] = val
+		} else {
+			snapshot[id] = opt.value.Interface()
+		}
+	}
+	return snapshot
+}
+
+// markRead records a read of the option and all its sub-options.
+func (c *Config) markRead(opt *option) {
+	c.reads[opt.fullID()]++
+	for _, sub := range opt.subOpts {
+		c.markRead(sub)
+	}
+}
+
+// Reads returns the number of times the option with the given full ID has
+// been read through Get.  It always returns zero for handles that have not
+// been created with Instrument.
+func (c *Config) Reads(id string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.reads[id]
+}
+
+// Unread returns the full IDs of all options that have never been read
+// through Get, sorted alphabetically.  Nested options are only listed by
+// their children.
+// It returns nil for handles that have not been created with Instrument.
+func (c *Config) Unread() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.tracked {
+		return nil
+	}
+
+	var unread []string
+	for _, id := range c.order {
+		if c.opts[id].isParent {
+			continue
+		}
+		if c.reads[id] == 0 {
+			unread = append(unread, id)
+		}
+	}
+
+	sort.Strings(unread)
+	return unread
+}
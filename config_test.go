@@ -0,0 +1,168 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	config := &struct {
+		Port   int `default:"8080"`
+		Unused string
+		Nested struct {
+			Inner1 int
+			Inner2 int
+		}
+		Other struct {
+			Inner int
+		}
+	}{}
+	setOS(nil, nil)
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+
+	c := Instrument(config)
+
+	port, ok := c.Get("port")
+	require.True(t, ok)
+	assert.Equal(t, 8080, port)
+
+	_, ok = c.Get("nested")
+	require.True(t, ok)
+	_, ok = c.Get("other.inner")
+	require.True(t, ok)
+	_, ok = c.Get("doesnotexist")
+	require.False(t, ok)
+
+	assert.Equal(t, 1, c.Reads("port"))
+	assert.Equal(t, 1, c.Reads("nested.inner1"))
+	assert.Equal(t, []string{"unused"}, c.Unread())
+}
+
+func TestConfig_WithOverrides(t *testing.T) {
+	config := &struct {
+		Port   int
+		Host   string
+		Nested struct {
+			Inner int
+		}
+	}{Port: 8080, Host: "localhost"}
+	c := NewConfig(config)
+
+	ctx, err := c.WithOverrides(context.Background(), map[string]interface{}{
+		"port":         "9090",
+		"nested.inner": 5,
+	})
+	require.NoError(t, err)
+	inner, err := c.WithOverrides(ctx, map[string]interface{}{
+		"host": "example.com",
+	})
+	require.NoError(t, err)
+
+	port, ok := c.GetContext(inner, "port")
+	require.True(t, ok)
+	assert.Equal(t, 9090, port)
+	assert.Equal(t, map[string]interface{}{
+		"port":         9090,
+		"host":         "example.com",
+		"nested.inner": 5,
+	}, c.Snapshot(inner))
+
+	host, _ := c.GetContext(ctx, "host")
+	assert.Equal(t, "localhost", host)
+	port, _ = c.GetContext(context.Background(), "port")
+	assert.Equal(t, 8080, port)
+	assert.Equal(t, 8080, config.Port)
+
+	_, err = c.WithOverrides(ctx, map[string]interface{}{"nested": 5})
+	assert.Error(t, err)
+	_, err = c.WithOverrides(ctx, map[string]interface{}{"port": "strng"})
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_Set(t *testing.T) {
+	config := &struct {
+		Port   int    `default:"8080"`
+		Level  string `oneof:"debug,info" normalize:"lower" default:"info"`
+		Nested struct {
+			Hosts []string
+		}
+	}{}
+	setOS(nil, nil)
+	c, err := LoadConfig(config, Conf{FileDisable: true})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Set("port", "9090"))
+	assert.Equal(t, 9090, config.Port)
+	port, _ := c.Get("port")
+	assert.Equal(t, 9090, port)
+
+	require.NoError(t, c.Set("level", "DEBUG"))
+	assert.Equal(t, "debug", config.Level)
+
+	require.NoError(t, c.Set("nested.hosts", "a,b"))
+	assert.Equal(t, []string{"a", "b"}, config.Nested.Hosts)
+
+	assert.Error(t, c.Set("port", "abc"))
+	assert.Error(t, c.Set("level", "warn"))
+	assert.Error(t, c.Set("nested", "x"))
+	assert.Error(t, c.Set("doesnotexist", "x"))
+	assert.Equal(t, 9090, config.Port)
+	assert.Equal(t, "debug", config.Level)
+}
+
+func TestLoadConfig_WasSet(t *testing.T) {
+	requireFlags(t)
+
+	config := &struct {
+		Port    int `default:"8080"`
+		Workers int
+		Backlog int `fallback:"workers"`
+		Nested  struct {
+			Host string `default:"localhost"`
+			Name string
+		}
+	}{}
+	setOS([]string{"--workers", "4"}, map[string]string{"NESTED_NAME": "x"})
+	c, err := LoadConfig(config, Conf{FileDisable: true})
+	require.NoError(t, err)
+
+	assert.False(t, c.WasSet("port"))
+	assert.True(t, c.WasSet("workers"))
+	assert.True(t, c.WasSet("backlog"))
+	assert.False(t, c.WasSet("nested.host"))
+	assert.True(t, c.WasSet("nested.name"))
+	assert.True(t, c.WasSet("nested"))
+	assert.False(t, c.WasSet("doesnotexist"))
+
+	// Handles that are not created by loading know no sources.
+	assert.False(t, NewConfig(config).WasSet("workers"))
+}
+
+func TestConfig_SetConcurrent(t *testing.T) {
+	config := &struct {
+		Port int
+	}{}
+	c := NewConfig(config)
+
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				c.Set("port", "1")
+				c.Get("port")
+			}
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	assert.Equal(t, 1, config.Port)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"context"
+	"fmt"
+)
+
+// CustomSource is a user-provided source of config variables.
+type CustomSource interface {
+	// Load returns the values of the config variables in a map structured
+	// like a decoded config file: nested config variables are in nested
+	// maps.  Implementations that perform I/O should respect the context.
+	Load(ctx context.Context) (map[string]interface{}, error)
+}
+
+// CustomSourceFunc is a function that implements CustomSource.
+type CustomSourceFunc func(ctx context.Context) (map[string]interface{}, error)
+
+// Load calls f(ctx).
+func (f CustomSourceFunc) Load(ctx context.Context) (map[string]interface{}, error) {
+	return f(ctx)
+}
+
+// parseCustomSources loads the custom sources in the Conf in order and writes
+// the values that have been found in place.
+func parseCustomSources(s *setup) error {
+	for i, source := range s.conf.CustomSources {
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+
+		m, err := source.Load(s.ctx)
+		if err != nil {
+			return fmt.Errorf("error loading custom source %d: %w", i, err)
+		}
+
+		if err := parseMapOpts(s, m, s.opts, SourceCustom); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Defaulter can be implemented by config structs to compute default values
+// that can not be expressed as a static default tag.  Default is called for
+// every config variable with its full ID and if it returns true, the returned
+// value is used as the default value, taking precedence over the default tag.
+// Conf.DefaultFunc takes precedence over Defaulter.
+type Defaulter interface {
+	Default(id string) (string, bool)
+}
+
+// multiDefaulter combines the Defaulters of multiple config structs.
+type multiDefaulter []Defaulter
+
+// Default returns the first default value provided by any of the Defaulters.
+func (m multiDefaulter) Default(id string) (string, bool) {
+	for _, defaulter := range m {
+		if def, ok := defaulter.Default(id); ok {
+			return def, true
+		}
+	}
+	return "", false
+}
+
+// computeDefault replaces the default value of the option with the computed
+// one, if any, and reports whether it did.
+func computeDefault(s *setup, opt *option) bool {
+	var def string
+	var ok bool
+	if s.conf.DefaultFunc != nil {
+		def, ok = s.conf.DefaultFunc(opt.info())
+	}
+	if !ok && s.defaulter != nil {
+		def, ok = s.defaulter.Default(opt.fullID())
+	}
+
+	if ok {
+		opt.defaul = def
+		opt.defaultSet = true
+	}
+	return ok
+}
+
+// checkDefaults panics if err is an error in the static default values, which
+// is a problem with the config struct, and returns it if it is an error in the
+// computed default values.
+func checkDefaults(err error) error {
+	if err == nil {
+		return nil
+	}
+	var parseErr *ParseError
+	var validationErr *ValidationError
+	if errors.As(err, &parseErr) || errors.As(err, &validationErr) {
+		return err
+	}
+	panic(fmt.Errorf("error in default values: %s", err))
+}
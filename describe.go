@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldDescriber can be implemented by config structs, and the struct types
+// of nested config vars, to provide the descriptions of the config vars of
+// their fields that do not have a desc tag.  FieldDescription is called with
+// the name of the struct field.  The implementation is usually generated from
+// the doc comments of the fields with GenerateDescriptions or the
+// cmd/gonfig-doc command, so that the help message stays in sync with the
+// code.
+type FieldDescriber interface {
+	FieldDescription(field string) (string, bool)
+}
+
+// fieldDescription returns the description of the field of the struct value v
+// provided by its FieldDescriber implementation, if any.
+func fieldDescription(v reflect.Value, field string) string {
+	describer, ok := v.Interface().(FieldDescriber)
+	if !ok && v.CanAddr() {
+		describer, ok = v.Addr().Interface().(FieldDescriber)
+	}
+	if !ok {
+		return ""
+	}
+
+	desc, _ := describer.FieldDescription(field)
+	return desc
+}
+
+// docText returns the text of the doc comment as a single line.
+func docText(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// GenerateDescriptions generates the Go source code of FieldDescriber
+// implementations for the struct types in the Go source file src, that
+// return the doc comments of their fields, or the line comments of fields
+// without a doc comment.  If types is empty, implementations are generated
+// for all struct types with commented fields, otherwise only for the given
+// types.  Fields of anonymous struct types are left out, as no methods can
+// be declared on them.
+//
+// It is meant to be invoked through the cmd/gonfig-doc command in a
+// go:generate directive:
+//
+//	//go:generate gonfig-doc -o config_desc.go config.go
+func GenerateDescriptions(src []byte, types []string) ([]byte, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(types))
+	for _, name := range types {
+		wanted[name] = true
+	}
+
+	var body bytes.Buffer
+	found := make(map[string]bool)
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			name := typeSpec.Name.Name
+			if !ok || len(types) > 0 && !wanted[name] {
+				continue
+			}
+			found[name] = true
+
+			var cases bytes.Buffer
+			for _, field := range structType.Fields.List {
+				desc := docText(field.Doc)
+				if desc == "" {
+					desc = docText(field.Comment)
+				}
+				if desc == "" {
+					continue
+				}
+				for _, fieldName := range field.Names {
+					fmt.Fprintf(&cases, "case %q:\nreturn %s, true\n",
+						fieldName.Name, strconv.Quote(desc))
+				}
+			}
+			if cases.Len() == 0 && len(types) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(&body, "\n// FieldDescription implements "+
+				"gonfig.FieldDescriber for %s.\n", name)
+			fmt.Fprintf(&body, "func (%s) FieldDescription(field string) "+
+				"(string, bool) {\n", name)
+			if cases.Len() > 0 {
+				fmt.Fprintf(&body, "switch field {\n%s}\n", cases.Bytes())
+			}
+			body.WriteString("return \"\", false\n}\n")
+		}
+	}
+
+	for _, name := range types {
+		if !found[name] {
+			return nil, fmt.Errorf("struct type %s not found", name)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gonfig-doc. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n", file.Name.Name)
+	body.WriteTo(&buf)
+
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type describedConfig struct {
+	Port   int
+	Host   string `desc:"from the tag"`
+	Server describedServer
+}
+
+func (describedConfig) FieldDescription(field string) (string, bool) {
+	switch field {
+	case "Port":
+		return "the port to listen on", true
+	case "Host":
+		return "from the doc comment", true
+	}
+	return "", false
+}
+
+type describedServer struct {
+	Name string
+}
+
+func (*describedServer) FieldDescription(field string) (string, bool) {
+	return "the " + field, true
+}
+
+func TestInspect_FieldDescriber(t *testing.T) {
+	s := &setup{conf: &Conf{}}
+	require.NoError(t, inspectConfigStructure(s, &describedConfig{}))
+
+	descs := make(map[string]string)
+	for _, opt := range s.allOpts {
+		descs[opt.fullID()] = opt.desc
+	}
+	assert.Equal(t, "the port to listen on", descs["port"])
+	assert.Equal(t, "from the tag", descs["host"])
+	assert.Equal(t, "the Name", descs["server.name"])
+}
+
+func TestGenerateDescriptions(t *testing.T) {
+	src := []byte(`package config
+
+// Config is the configuration.
+type Config struct {
+	// Port is the port to listen on.
+	// It must be above 1024.
+	Port int
+	Host string // the "host" name
+	A, B bool // two flags
+	Undocumented string
+	Nested struct {
+		// Not generated.
+		X int
+	}
+}
+
+type Other struct {
+	Name string
+}
+
+type NotAStruct int
+`)
+
+	generated, err := GenerateDescriptions(src, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `// Code generated by gonfig-doc. DO NOT EDIT.
+
+package config
+
+// FieldDescription implements gonfig.FieldDescriber for Config.
+func (Config) FieldDescription(field string) (string, bool) {
+	switch field {
+	case "Port":
+		return "Port is the port to listen on. It must be above 1024.", true
+	case "Host":
+		return "the \"host\" name", true
+	case "A":
+		return "two flags", true
+	case "B":
+		return "two flags", true
+	}
+	return "", false
+}
+`, string(generated))
+
+	generated, err = GenerateDescriptions(src, []string{"Other"})
+	require.NoError(t, err)
+	assert.Contains(t, string(generated), "func (Other) FieldDescription")
+	assert.NotContains(t, string(generated), "func (Config)")
+
+	_, err = GenerateDescriptions(src, []string{"Missing"})
+	assert.Error(t, err)
+}
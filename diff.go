@@ -0,0 +1,82 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change describes a config variable that has a different value in two
+// configurations.
+type Change struct {
+	// Option is the full ID of the config variable, like "server.port".
+	Option string
+	// Old is the value in the old configuration.  It is nil for secret config
+	// variables and for pointers that are nil.
+	Old interface{}
+	// New is the value in the new configuration.  It is nil for secret config
+	// variables and for pointers that are nil.
+	New interface{}
+	// Secret indicates that the config variable is secret, so that its values
+	// are not included.
+	Secret bool
+}
+
+// changeValue returns the value of the option as included in a Change.
+func changeValue(opt *option) interface{} {
+	if opt.secret {
+		return nil
+	}
+	if opt.isPointer {
+		if opt.value.IsNil() {
+			return nil
+		}
+		return opt.value.Elem().Interface()
+	}
+	return opt.value.Interface()
+}
+
+// Diff returns the changes between the configurations in the config structs
+// at old and new, which must be pointers to structs of the same type.  The
+// changes are in the order of the fields in the struct, like the options in
+// the help message.  This can be used to log what changed when the
+// configuration is reloaded, or to detect changes that require a restart.
+// An error is returned if there is a problem with the configuration struct.
+func Diff(old, new interface{}) ([]Change, error) {
+	if reflect.TypeOf(old) != reflect.TypeOf(new) {
+		return nil, fmt.Errorf("can not compare configs of different types "+
+			"%T and %T", old, new)
+	}
+
+	oldSetup := &setup{conf: &Conf{}}
+	if err := inspectConfigStructure(oldSetup, old); err != nil {
+		return nil, fmt.Errorf("error in config structure: %s", err)
+	}
+	newSetup := &setup{conf: &Conf{}}
+	if err := inspectConfigStructure(newSetup, new); err != nil {
+		return nil, fmt.Errorf("error in config structure: %s", err)
+	}
+
+	var changes []Change
+	for i, oldOpt := range oldSetup.allOpts {
+		newOpt := newSetup.allOpts[i]
+		if oldOpt.isParent {
+			continue
+		}
+		if reflect.DeepEqual(oldOpt.value.Interface(), newOpt.value.Interface()) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Option: oldOpt.fullID(),
+			Old:    changeValue(oldOpt),
+			New:    changeValue(newOpt),
+			Secret: oldOpt.secret,
+		})
+	}
+
+	return changes, nil
+}
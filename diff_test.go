@@ -0,0 +1,54 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	type config struct {
+		Port     int
+		Host     string
+		Password string `secret:"true"`
+		Timeout  *int
+		Nested   struct {
+			Names []string
+		}
+	}
+	timeout := 5
+	c1 := &config{Port: 8080, Host: "localhost", Password: "a"}
+	c1.Nested.Names = []string{"one", "two"}
+	c2 := &config{Port: 8080, Host: "localhost", Password: "a"}
+	c2.Nested.Names = []string{"one", "two"}
+
+	changes, err := Diff(c1, c2)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	c2.Port = 8081
+	c2.Password = "b"
+	c2.Timeout = &timeout
+	c2.Nested.Names = []string{"one"}
+	changes, err = Diff(c1, c2)
+	require.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Option: "port", Old: 8080, New: 8081},
+		{Option: "password", Secret: true},
+		{Option: "timeout", Old: nil, New: 5},
+		{Option: "nested.names", Old: []string{"one", "two"}, New: []string{"one"}},
+	}, changes)
+
+	_, err = Diff(c1, &struct{ Port int }{})
+	assert.Error(t, err)
+
+	invalid := &struct{ Map map[string]string }{}
+	_, err = Diff(invalid, invalid)
+	assert.EqualError(t, err, "error in config structure: "+
+		"type of field Map (map[string]string) is not supported")
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirKeySeparator separates the keys of nested config variables in the file
+// names of the directory source.
+const dirKeySeparator = "__"
+
+// readDir reads the files in the directory, and its subdirectories, into a
+// map that is structured like a decoded config file.  Hidden files, like the
+// "..data" links of Kubernetes volumes, are skipped.
+func readDir(dir string) (map[string]interface{}, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		// Follow symbolic links, as the mounted files usually are.
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var val interface{}
+		if info.IsDir() {
+			if val, err = readDir(path); err != nil {
+				return nil, err
+			}
+		} else {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			value := strings.TrimSuffix(string(content), "\n")
+			val = strings.TrimSuffix(value, "\r")
+		}
+
+		// Nested keys can be joined in the file name, like "server__port".
+		keys := strings.Split(entry.Name(), dirKeySeparator)
+		parent := m
+		for _, key := range keys[:len(keys)-1] {
+			nested, ok := parent[key].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				parent[key] = nested
+			}
+			parent = nested
+		}
+		key := keys[len(keys)-1]
+		if existing, ok := parent[key].(map[string]interface{}); ok {
+			if nested, ok := val.(map[string]interface{}); ok {
+				deepMerge(existing, nested)
+				continue
+			}
+		}
+		parent[key] = val
+	}
+
+	return m, nil
+}
+
+// parseDir parses the files in the directory configured in the Conf and
+// writes the values that have been found in place.
+func parseDir(s *setup) error {
+	if _, err := os.Stat(s.conf.DirSource); os.IsNotExist(err) {
+		return nil
+	}
+
+	m, err := readDir(s.conf.DirSource)
+	if err != nil {
+		return fmt.Errorf("failed to read config directory %s: %s",
+			s.conf.DirSource, err)
+	}
+
+	// Files for unknown keys are ignored, as the directory might hold other
+	// values too.
+	return parseMapOpts(s, m, s.opts, SourceDir)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDNSCacheTTL is the time TXT records are cached when no TTL is
+// configured.
+const defaultDNSCacheTTL = 5 * time.Minute
+
+// dnsCacheEntry holds the cached TXT records for a zone.
+type dnsCacheEntry struct {
+	records []string
+	expiry  time.Time
+}
+
+// The cache of TXT records, shared among all loads.
+var (
+	dnsCacheMtx sync.Mutex
+	dnsCache    = make(map[string]dnsCacheEntry)
+)
+
+// lookupDNSRecords returns the TXT records for the zone in the Conf, either
+// from the cache or by performing the lookup.  The cache is not locked during
+// the lookup, so concurrent loads might both look up the records.
+func lookupDNSRecords(s *setup) ([]string, error) {
+	zone := s.conf.DNSZone
+
+	dnsCacheMtx.Lock()
+	entry, ok := dnsCache[zone]
+	dnsCacheMtx.Unlock()
+	if ok && time.Now().Before(entry.expiry) {
+		return entry.records, nil
+	}
+
+	lookup := s.conf.DNSLookupTXT
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupTXT
+	}
+	records, err := lookup(s.ctx, zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up TXT records for %s: %s",
+			zone, err)
+	}
+
+	ttl := s.conf.DNSCacheTTL
+	if ttl == 0 {
+		ttl = defaultDNSCacheTTL
+	}
+	if ttl > 0 {
+		dnsCacheMtx.Lock()
+		dnsCache[zone] = dnsCacheEntry{
+			records: records,
+			expiry:  time.Now().Add(ttl),
+		}
+		dnsCacheMtx.Unlock()
+	}
+
+	return records, nil
+}
+
+// parseDNS parses the TXT records of the zone configured in the Conf and
+// writes the values that have been found in place.  Every record containing a
+// key=value pair, where the key is the full ID of an option, sets that option.
+// Other records are ignored.
+func parseDNS(s *setup) error {
+	records, err := lookupDNSRecords(s)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*option)
+	for _, opt := range s.allOpts {
+		if !opt.isParent {
+			byID[opt.fullID()] = opt
+		}
+	}
+
+	for _, record := range records {
+		parts := strings.SplitN(record, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		opt, ok := byID[strings.TrimSpace(parts[0])]
+		if !ok {
+			continue
+		}
+
+		value, err := resolveSecret(s, opt, parts[1])
+		if err != nil {
+			return err
+		}
+
+		before := opt.value.Interface()
+		if err := opt.setValueByString(value); err != nil {
+			return newParseError(opt, SourceDNS, value, err)
+		}
+		if err := sourceSet(s, opt, SourceDNS, before); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The formats supported by Dump.
+const (
+	DumpYAML = "yaml"
+	DumpJSON = "json"
+)
+
+// secretMask replaces the values of secret config variables in dumps.
+const secretMask = "***"
+
+// dumpValue returns the value as it is shown in a dump.  Values that are
+// parsed from text, like durations and sizes, are shown as text.
+func dumpValue(v reflect.Value) (interface{}, error) {
+	_, isMarshaler := v.Interface().(encoding.TextMarshaler)
+	if isMarshaler || v.Type() == typeOfDuration || v.Type() == typeOfByteSlice {
+		return formatSimpleValue(v)
+	}
+	return v.Interface(), nil
+}
+
+// dumpValues returns the values of the options as nested maps, like the ones
+// decoded from a config file.  The values of secret options are masked.
+func dumpValues(opts []*option) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(opts))
+	for _, opt := range opts {
+		var err error
+		switch {
+		case opt.isParent:
+			m[opt.id], err = dumpValues(opt.subOpts)
+
+		case opt.secret:
+			m[opt.id] = secretMask
+
+		case opt.elemType != nil:
+			list := make([]interface{}, 0, opt.value.Len())
+			for i := 0; i < opt.value.Len(); i++ {
+				elem := opt.value.Index(i)
+				if elem.Kind() == reflect.Ptr {
+					if elem.IsNil() {
+						list = append(list, nil)
+						continue
+					}
+					elem = elem.Elem()
+				}
+				elemOpts, _, err := createOptionsFromStruct(
+					elem, elemParent(opt, fmt.Sprintf("[%d]", i)))
+				if err != nil {
+					return nil, err
+				}
+				values, err := dumpValues(elemOpts)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, values)
+			}
+			m[opt.id] = list
+
+		case opt.isPointer && opt.value.IsNil():
+			m[opt.id] = nil
+
+		default:
+			v := opt.value
+			if opt.isPointer {
+				v = v.Elem()
+			}
+			if !opt.isSlice {
+				m[opt.id], err = dumpValue(v)
+				break
+			}
+
+			list := make([]interface{}, v.Len())
+			for i := range list {
+				if list[i], err = dumpValue(v.Index(i)); err != nil {
+					break
+				}
+			}
+			m[opt.id] = list
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error dumping %s: %s", opt.fullID(), err)
+		}
+	}
+	return m, nil
+}
+
+// Dump writes the configuration in the config struct at c to w in the given
+// format, DumpYAML or DumpJSON, like it would be written in a config file.
+// This can be used to log the effective configuration at startup.  The
+// values of secret config variables are masked as "***", so they never end
+// up in the logs.  The conf should be the one used to load the
+// configuration.  An error is returned if there is a problem with the
+// configuration struct.
+func Dump(c interface{}, conf Conf, w io.Writer, format string) error {
+	s := &setup{
+		conf: &conf,
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		return fmt.Errorf("error in config structure: %s", err)
+	}
+
+	values, err := dumpValues(s.opts)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	switch format {
+	case DumpYAML:
+		out, err = yaml.Marshal(values)
+	case DumpJSON:
+		out, err = json.MarshalIndent(values, "", "  ")
+		out = append(out, '\n')
+	default:
+		return fmt.Errorf("unknown dump format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
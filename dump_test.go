@@ -0,0 +1,74 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDump(t *testing.T) {
+	type Config struct {
+		Port     int
+		Timeout  time.Duration
+		Limit    ByteSize
+		Hosts    []string
+		Verbose  *bool
+		Password string `secret:"true"`
+		Database struct {
+			URL   string
+			Token string `secret:"true"`
+		}
+		Upstreams []struct {
+			Addr string
+			Key  string `secret:"true"`
+		}
+	}
+
+	config := &Config{
+		Port:     8080,
+		Timeout:  90 * time.Second,
+		Limit:    512 * MiB,
+		Hosts:    []string{"a", "b"},
+		Password: "hunter2",
+	}
+	config.Database.URL = "postgres://db"
+	config.Database.Token = "t0ken"
+	config.Upstreams = append(config.Upstreams, struct {
+		Addr string
+		Key  string `secret:"true"`
+	}{"up:80", "k3y"})
+
+	var buf bytes.Buffer
+	require.NoError(t, Dump(config, Conf{}, &buf, DumpJSON))
+	assert.JSONEq(t, `{
+		"port": 8080,
+		"timeout": "1m30s",
+		"limit": "512MiB",
+		"hosts": ["a", "b"],
+		"verbose": null,
+		"password": "***",
+		"database": {"url": "postgres://db", "token": "***"},
+		"upstreams": [{"addr": "up:80", "key": "***"}]
+	}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, Dump(config, Conf{}, &buf, DumpYAML))
+	assert.Contains(t, buf.String(), "timeout: 1m30s\n")
+	assert.Contains(t, buf.String(), "password: '***'\n")
+	for _, secret := range []string{"hunter2", "t0ken", "k3y"} {
+		assert.NotContains(t, buf.String(), secret)
+	}
+
+	assert.Error(t, Dump(config, Conf{}, &buf, "xml"))
+
+	assert.EqualError(t, Dump(&struct{ Map map[string]string }{}, Conf{},
+		&buf, DumpJSON), "error in config structure: "+
+		"type of field Map (map[string]string) is not supported")
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The units for days and weeks that are accepted in durations, in addition to
+// the ones of time.ParseDuration.  A day is always 24 hours.
+const (
+	Day  = 24 * time.Hour
+	Week = 7 * Day
+)
+
+var typeOfDuration = reflect.TypeOf(time.Duration(0))
+
+// durationUnits are the units accepted by time.ParseDuration.
+var durationUnits = []string{"ns", "us", "µs", "μs", "ms", "s", "m", "h"}
+
+// ParseDuration parses a duration like time.ParseDuration, but also accepts
+// the units "d" for days and "w" for weeks, like "2d", "1w" or "1d12h".  As
+// time.Duration is an integer type, a number without a unit is a number of
+// nanoseconds.
+func ParseDuration(s string) (time.Duration, error) {
+	str := strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Duration(n), nil
+	}
+
+	rest, negative := str, false
+	if rest != "" && (rest[0] == '-' || rest[0] == '+') {
+		rest, negative = rest[1:], rest[0] == '-'
+	}
+	if rest == "" {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+
+	isNumber := func(r rune) bool {
+		return r >= '0' && r <= '9' || r == '.'
+	}
+
+	// The days and weeks are added up separately, all other components are
+	// left to time.ParseDuration.
+	var days time.Duration
+	var other strings.Builder
+	for rest != "" {
+		i := strings.IndexFunc(rest, func(r rune) bool { return !isNumber(r) })
+		if i <= 0 {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		j := strings.IndexFunc(rest[i:], isNumber)
+		if j == -1 {
+			j = len(rest) - i
+		}
+		number, unit := rest[:i], rest[i:i+j]
+		rest = rest[i+j:]
+
+		var size time.Duration
+		switch unit {
+		case "d":
+			size = Day
+		case "w":
+			size = Week
+		default:
+			known := false
+			for _, u := range durationUnits {
+				if unit == u {
+					known = true
+					break
+				}
+			}
+			if !known {
+				return 0, fmt.Errorf("unknown unit '%s' in duration '%s'",
+					unit, s)
+			}
+			other.WriteString(number + unit)
+			continue
+		}
+
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil || float64(days)+f*float64(size) >= math.MaxInt64 {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+		days += time.Duration(f * float64(size))
+	}
+
+	var d time.Duration
+	if other.Len() > 0 {
+		var err error
+		if d, err = time.ParseDuration(other.String()); err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", s)
+		}
+	}
+	if d > math.MaxInt64-days {
+		return 0, fmt.Errorf("invalid duration '%s'", s)
+	}
+
+	d += days
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
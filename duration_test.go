@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	for str, expected := range map[string]time.Duration{
+		"0":        0,
+		"1000":     1000,
+		"1h30m":    90 * time.Minute,
+		"2d":       2 * Day,
+		"1w":       Week,
+		"1d12h":    36 * time.Hour,
+		"1w2d3h4m": Week + 2*Day + 3*time.Hour + 4*time.Minute,
+		"1.5d":     36 * time.Hour,
+		" -2d ":    -2 * Day,
+		"+1w":      Week,
+		"500ms":    500 * time.Millisecond,
+	} {
+		d, err := ParseDuration(str)
+		require.NoError(t, err, str)
+		assert.Equal(t, expected, d, str)
+	}
+
+	for _, str := range []string{"", "-", "d", "1x", "1d2", "1.2.3d",
+		"99999999w", "1dd"} {
+		_, err := ParseDuration(str)
+		assert.Error(t, err, str)
+	}
+}
+
+func TestLoad_Duration(t *testing.T) {
+	requireFlags(t)
+
+	setOS([]string{"--retention", "2w"}, map[string]string{"EXPIRY": "1d12h"})
+	config := &struct {
+		Retention time.Duration
+		Expiry    time.Duration
+		Timeout   time.Duration `default:"30s"`
+		File      time.Duration
+		Nanos     time.Duration
+		Intervals []time.Duration
+	}{}
+	require.NoError(t, LoadWithRawFile(config,
+		[]byte(`{"file": "3d", "nanos": 1000, "intervals": ["1d", "1h"]}`),
+		Conf{FileDecoder: DecoderJSON}))
+
+	assert.Equal(t, 2*Week, config.Retention)
+	assert.Equal(t, 36*time.Hour, config.Expiry)
+	assert.Equal(t, 30*time.Second, config.Timeout)
+	assert.Equal(t, 3*Day, config.File)
+	assert.Equal(t, time.Duration(1000), config.Nanos)
+	assert.Equal(t, []time.Duration{Day, time.Hour}, config.Intervals)
+
+	setOS([]string{"--retention", "2x"}, nil)
+	err := Load(config, Conf{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown unit 'x'")
+}
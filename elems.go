@@ -0,0 +1,234 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// structElemType returns the struct type of the elements of the slice type t,
+// if the elements are structs or pointers to structs that are not parsed from
+// text.
+func structElemType(t reflect.Type) (reflect.Type, bool) {
+	elem := t.Elem()
+	if elem.Implements(typeOfTextUnmarshaler) {
+		return nil, false
+	}
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	return elem, elem.Kind() == reflect.Struct
+}
+
+// elemParent returns an option that acts as the parent of the options of an
+// element of the list of structs of opt.  The index is the last part of its
+// ID, like "[2]".
+func elemParent(opt *option, index string) *option {
+	parts := make([]string, len(opt.fullIDParts)+1)
+	copy(parts, opt.fullIDParts)
+	parts[len(parts)-1] = index
+	return &option{id: index, fullIDParts: parts, group: opt.group}
+}
+
+// inspectElemStruct inspects the struct type of the elements of the list of
+// structs of the option and returns the options of an element.  The tags that
+// relate options across the whole config struct, or to flags, are not
+// supported for the fields of the elements.
+func inspectElemStruct(opt *option, t reflect.Type) ([]*option, error) {
+	if opt.defaultSet {
+		return nil, fmt.Errorf("default value not supported for list of "+
+			"structs %s", opt.fullID())
+	}
+
+	opts, allOpts, err := createOptionsFromStruct(
+		reflect.New(t).Elem(), elemParent(opt, "[]"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, elemOpt := range allOpts {
+		for _, tag := range []struct {
+			name, value string
+		}{
+			{fieldTagShort, elemOpt.short},
+			{fieldTagAssert, elemOpt.assert},
+			{fieldTagMetadata, elemOpt.metadata},
+			{fieldTagFallback, elemOpt.fallback},
+		} {
+			if tag.value != "" {
+				return nil, fmt.Errorf("%s tag not supported for %s in a "+
+					"list of structs", tag.name, elemOpt.fullID())
+			}
+		}
+	}
+
+	if err := checkNormalizers(allOpts); err != nil {
+		return nil, err
+	}
+	if err := checkSources(allOpts); err != nil {
+		return nil, err
+	}
+	if err := compileValidations(allOpts); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// structElem returns the struct value of the element at index i of the list,
+// allocating it if the element is a nil pointer.
+func structElem(list reflect.Value, i int) reflect.Value {
+	elem := list.Index(i)
+	if elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		return elem.Elem()
+	}
+	return elem
+}
+
+// elemOptions creates the options for the struct value elem of the element
+// at index i of the list of structs of the option.  Default values are written
+// for new elements.
+func elemOptions(s *setup, opt *option, elem reflect.Value, i int, isNew bool) ([]*option, []*option, error) {
+	opts, allOpts, err := createOptionsFromStruct(
+		elem, elemParent(opt, fmt.Sprintf("[%d]", i)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := compileValidations(allOpts); err != nil {
+		return nil, nil, err
+	}
+
+	if isNew {
+		if err := setDefaultValues(s, allOpts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return opts, allOpts, nil
+}
+
+// parseMapElems parses the list of structs of the option from a list of maps,
+// like the ones decoded from a config file.  The list replaces the current
+// value of the option.
+func parseMapElems(s *setup, opt *option, val interface{}, source Source) error {
+	list, ok := val.([]interface{})
+	if !ok {
+		return fmt.Errorf("error parsing %s: value of type %s given for "+
+			"list of structs config var %s", source, reflect.TypeOf(val),
+			opt.fullID())
+	}
+
+	elems := reflect.MakeSlice(opt.value.Type(), len(list), len(list))
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("error parsing %s: value of type %s given for "+
+				"%s[%d]", source, reflect.TypeOf(item), opt.fullID(), i)
+		}
+
+		opts, allOpts, err := elemOptions(s, opt, structElem(elems, i), i, true)
+		if err != nil {
+			return err
+		}
+		if err := parseMapOpts(s, m, opts, source); err != nil {
+			return err
+		}
+		if err := checkRequired(allOpts); err != nil {
+			return err
+		}
+	}
+
+	before := opt.value.Interface()
+	opt.value.Set(elems)
+	return sourceSet(s, opt, source, before)
+}
+
+// envSetWithPrefix returns whether any environment variable, either from the
+// process environment or from an env file, starts with the prefix.
+func envSetWithPrefix(s *setup, prefix string) bool {
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, prefix) {
+			return true
+		}
+	}
+	for key := range s.extraEnv {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseEnvElems parses the indexed environment variables for the elements of
+// the list of structs of the option, like UPSTREAMS_0_HOST.  The variables
+// update the existing elements and append new elements for the indices
+// following them, up to the first index for which no variable is set.
+func parseEnvElems(s *setup, opt *option) error {
+	n := opt.value.Len()
+	elems := reflect.MakeSlice(opt.value.Type(), n, n)
+	for i := 0; i < n; i++ {
+		// Copy the elements, so that the current value is left untouched.
+		current := opt.value.Index(i)
+		if current.Kind() == reflect.Ptr {
+			if current.IsNil() {
+				continue
+			}
+			current = current.Elem()
+		}
+		structElem(elems, i).Set(current)
+	}
+
+	changed := false
+	for i := 0; ; i++ {
+		prefix := envKey(s.conf.EnvPrefix,
+			elemParent(opt, fmt.Sprintf("[%d]", i)).fullIDParts) + "_"
+		if !envSetWithPrefix(s, prefix) {
+			if i >= n {
+				break
+			}
+			continue
+		}
+
+		isNew := i >= n
+		elem := reflect.New(opt.elemType).Elem()
+		if !isNew {
+			elem = structElem(elems, i)
+		}
+
+		_, allOpts, err := elemOptions(s, opt, elem, i, isNew)
+		if err != nil {
+			return err
+		}
+		if err := parseEnvOpts(s, allOpts); err != nil {
+			return err
+		}
+
+		if isNew {
+			if err := checkRequired(allOpts); err != nil {
+				return err
+			}
+			if opt.value.Type().Elem().Kind() == reflect.Ptr {
+				elem = elem.Addr()
+			}
+			elems = reflect.Append(elems, elem)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	before := opt.value.Interface()
+	opt.value.Set(elems)
+	return sourceSet(s, opt, SourceEnv, before)
+}
@@ -5,35 +5,268 @@
 package gonfig
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
-// getEnvVar reads the environment variable by an option's fullId and prefix
-// by joining all parts together with underscores and putting all to upper case.
-func getEnvVar(prefix string, fullID []string) (string, bool) {
+// defaultDotEnvFile is the dotenv file that is loaded when present if no other
+// file is configured.
+const defaultDotEnvFile = ".env"
+
+// envKey returns the name of the environment variable for an option's fullId
+// and prefix by joining all parts together with underscores and putting all to
+// upper case.
+func envKey(prefix string, fullID []string) string {
 	key := strings.Join(fullID, "_")
-	key = strings.Replace(key, "-", "_", -1)
+	key = envKeyReplacer.Replace(key)
 	key = prefix + key
-	key = strings.ToUpper(key)
+	return strings.ToUpper(key)
+}
+
+// envKeyReplacer replaces the characters of IDs that are not used in the
+// names of environment variables.
+var envKeyReplacer = strings.NewReplacer("-", "_", "[", "", "]", "")
+
+// getEnvVar reads the environment variable for an option's fullId.
+// Variables in the process environment take precedence over the ones loaded
+// from env files, which in turn take precedence over the dotenv file.
+func getEnvVar(s *setup, fullID []string) (string, bool) {
+	return lookupEnvKey(s, envKey(s.conf.EnvPrefix, fullID))
+}
+
+// lookupEnvKey reads the environment variable with the given name, either from
+// the process environment or from the env files.
+func lookupEnvKey(s *setup, key string) (string, bool) {
+	if val, found := os.LookupEnv(key); found {
+		return val, true
+	}
+
+	val, found := s.extraEnv[key]
+	return val, found
+}
+
+// parseEnvFile parses the content of an env file.  The format is the one
+// used by Docker: every line contains a KEY=value pair, empty lines and lines
+// starting with # are ignored and lines with only a key take the value of
+// that key from the process environment, if it is set.
+func parseEnvFile(content []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimLeft(strings.TrimSuffix(line, "\r"), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		key := parts[0]
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid variable name '%s' on line %d",
+				key, i+1)
+		}
+
+		if len(parts) == 1 {
+			if val, found := os.LookupEnv(key); found {
+				env[key] = val
+			}
+			continue
+		}
+		env[key] = parts[1]
+	}
+
+	return env, nil
+}
+
+// parseDotEnv parses the content of a dotenv file.  Every line contains a
+// KEY=value pair, optionally prefixed with "export".  Values can be quoted
+// with single or double quotes; in double quoted values, escape sequences like
+// \n are interpreted.  Empty lines and comments starting with # are ignored.
+func parseDotEnv(content []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid line %d: expected KEY=value", i+1)
+		}
+
+		value := strings.TrimSpace(parts[1])
+		switch {
+		case strings.HasPrefix(value, "\""):
+			unquoted, err := strconv.Unquote(value[:closingQuote(value)+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value on line %d: %s",
+					i+1, err)
+			}
+			value = unquoted
+
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted value on line %d",
+					i+1)
+			}
+			value = value[1 : end+1]
+
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// closingQuote returns the index of the double quote that closes the string
+// starting with a double quote at the beginning of s, or the index of the last
+// character if it is not closed.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return len(s) - 1
+}
+
+// loadDotEnv loads the variables from the dotenv file into the setup.
+// A missing dotenv file is ignored, unless it has been explicitly configured.
+func loadDotEnv(s *setup) error {
+	filename := s.conf.DotEnvFile
+	if filename == "" {
+		filename = defaultDotEnvFile
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) && s.conf.DotEnvFile == "" {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading dotenv file at %s: %s", filename, err)
+	}
+
+	env, err := parseDotEnv(content)
+	if err != nil {
+		return fmt.Errorf("error parsing dotenv file at %s: %s", filename, err)
+	}
+	for k, v := range env {
+		s.extraEnv[k] = v
+	}
+
+	return nil
+}
+
+// initEnv makes sure that the dotenv file and the env files are only loaded
+// once.  This method loads the variables from the dotenv file and the env
+// files passed through the env file flag into the setup; when called a second
+// time, it just returns nil.
+func initEnv(s *setup) error {
+	if s.extraEnv != nil {
+		return nil
+	}
+	s.extraEnv = make(map[string]string)
+
+	if !s.conf.DotEnvDisable {
+		if err := loadDotEnv(s); err != nil {
+			return err
+		}
+	}
+
+	filenames, err := lookupEnvFilesFlag(s)
+	if err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("error reading env file at %s: %s", filename, err)
+		}
+
+		env, err := parseEnvFile(content)
+		if err != nil {
+			return fmt.Errorf("error parsing env file at %s: %s", filename, err)
+		}
+		for k, v := range env {
+			s.extraEnv[k] = v
+		}
+	}
 
-	return os.LookupEnv(key)
+	return nil
 }
 
 // parseEnv parses the environment variables for all config options
 // and writes the values that have been found in place.
 func parseEnv(s *setup) error {
-	for _, opt := range s.allOpts {
+	if err := initEnv(s); err != nil {
+		return err
+	}
+
+	return parseEnvOpts(s, s.allOpts)
+}
+
+// parseEnvOpts parses the environment variables for the given options.
+func parseEnvOpts(s *setup, allOpts []*option) error {
+	for _, opt := range allOpts {
 		if opt.isParent {
 			continue
 		}
+		if opt.elemType != nil {
+			// Lists of structs are set by indexed variables.
+			if err := parseEnvElems(s, opt); err != nil {
+				return err
+			}
+			continue
+		}
 
-		value, set := getEnvVar(s.conf.EnvPrefix, opt.fullIDParts)
+		value, set := getEnvVar(s, opt.fullIDParts)
+		for _, alias := range opt.aliases {
+			if set {
+				break
+			}
+			aliasParts := aliasIDParts(opt, alias)
+			if value, set = getEnvVar(s, aliasParts); set {
+				warn(s, "environment variable %s is deprecated, use %s instead",
+					envKey(s.conf.EnvPrefix, aliasParts),
+					envKey(s.conf.EnvPrefix, opt.fullIDParts))
+			}
+		}
+		for _, alias := range tableAliasesFor(opt.fullID()) {
+			if set {
+				break
+			}
+			if value, set = lookupEnvKey(s, alias); set {
+				warn(s, "environment variable %s is deprecated, use %s instead",
+					alias, envKey(s.conf.EnvPrefix, opt.fullIDParts))
+			}
+		}
 		if !set {
 			continue
 		}
 
+		value, err := resolveSecret(s, opt, value)
+		if err != nil {
+			return err
+		}
+
+		before := opt.value.Interface()
 		if err := opt.setValueByString(value); err != nil {
+			return newParseError(opt, SourceEnv, value, err)
+		}
+		if err := sourceSet(s, opt, SourceEnv, before); err != nil {
 			return err
 		}
 	}
@@ -42,11 +275,93 @@ func parseEnv(s *setup) error {
 }
 
 // lookupConfigFileEnv looks for the config file in the environment variables.
+// The dotenv file and the env files are not loaded when EnvDisable is set.
 func lookupConfigFileEnv(s *setup, configOpt *option) (string, error) {
-	val, found := getEnvVar(s.conf.EnvPrefix, configOpt.fullIDParts)
+	if !s.conf.EnvDisable {
+		if err := initEnv(s); err != nil {
+			return "", err
+		}
+	}
+
+	val, found := getEnvVar(s, configOpt.fullIDParts)
 	if !found {
 		return "", nil
 	}
 
 	return val, nil
 }
+
+// environ appends the KEY=value pairs for the options to env.
+func environ(conf *Conf, allOpts []*option, env []string) ([]string, error) {
+	for _, opt := range allOpts {
+		if opt.isParent || !opt.allowsSource(SourceEnv) ||
+			opt.secret && !conf.EnvExportSecrets {
+			continue
+		}
+
+		if opt.elemType != nil {
+			// Lists of structs are exported as indexed variables.
+			for i := 0; i < opt.value.Len(); i++ {
+				elem := opt.value.Index(i)
+				if elem.Kind() == reflect.Ptr {
+					if elem.IsNil() {
+						continue
+					}
+					elem = elem.Elem()
+				}
+				_, elemOpts, err := createOptionsFromStruct(
+					elem, elemParent(opt, fmt.Sprintf("[%d]", i)))
+				if err != nil {
+					return nil, err
+				}
+				if env, err = environ(conf, elemOpts, env); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		v := opt.value
+		if opt.isPointer {
+			if v.IsNil() {
+				continue
+			}
+			v = v.Elem()
+		}
+
+		var value string
+		var err error
+		if opt.isSlice {
+			value, err = formatSlice(v)
+		} else {
+			value, err = formatSimpleValue(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error formatting %s: %s", opt.fullID(), err)
+		}
+		env = append(env, envKey(conf.EnvPrefix, opt.fullIDParts)+"="+value)
+	}
+
+	return env, nil
+}
+
+// AsEnviron returns the configuration in the config struct at c as
+// environment variables in the KEY=value form of os.Environ, using the
+// variable names and Conf.EnvPrefix as Load would.  This can be used to pass
+// the configuration to child processes.  Secret config variables are left out,
+// unless Conf.EnvExportSecrets is set, and so are config variables that can
+// not be set from the environment and pointers that are nil.
+//
+// An error is returned if there is a problem with the configuration struct or
+// if a value can not be formatted.
+func AsEnviron(c interface{}, conf Conf) ([]string, error) {
+	s := &setup{
+		conf: &conf,
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		return nil, fmt.Errorf("error in config structure: %s", err)
+	}
+
+	return environ(s.conf, s.allOpts, nil)
+}
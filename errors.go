@@ -7,9 +7,148 @@ package gonfig
 import (
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"strings"
 )
 
+// ErrMissingRequired is the error wrapped by the errors returned when a
+// required config variable has not been provided by any source.
+var ErrMissingRequired = errors.New("missing required config variable")
+
+// ErrEmptyFile is the error wrapped by the error returned for an empty config
+// file when Conf.FileEmpty is EmptyFileError.
+var ErrEmptyFile = errors.New("config file is empty")
+
+// ParseError is returned when the value a source provides for a config
+// variable can not be parsed into the type of the variable.
+type ParseError struct {
+	// Option is the full ID of the config variable.
+	Option string
+	// Source is the source the value originates from.
+	Source Source
+	// Raw is the value as provided by the source.  It is left empty for
+	// secret config variables, and Err does not contain the value either.
+	Raw string
+	// Err is the underlying error.
+	Err error
+}
+
+// newParseError creates a new parse error for the option.
+func newParseError(opt *option, source Source, raw string, err error) *ParseError {
+	if opt.secret {
+		// The underlying error might contain the value as well.
+		raw = ""
+		err = fmt.Errorf("failed to parse secret value into type %s",
+			opt.value.Type())
+	}
+	return &ParseError{
+		Option: opt.fullID(),
+		Source: source,
+		Raw:    raw,
+		Err:    err,
+	}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid value for %s from %s: %s",
+		e.Option, e.Source, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned when a value does not satisfy the validation
+// tags of its config variable, like oneof, min, max and pattern.
+type ValidationError struct {
+	// Option is the full ID of the config variable, followed by the index of
+	// the element for slices, like "upstreams[2]".
+	Option string
+	// Source is the source of the value, if any.
+	Source Source
+	// Origin is the path of the config file, for values from a config file.
+	Origin string
+	// Reason describes why the value is invalid.
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	switch {
+	case e.Origin != "":
+		return fmt.Sprintf("%s: %s (%s: %s)", e.Option, e.Reason, e.Source, e.Origin)
+	case e.Source != "":
+		return fmt.Sprintf("%s: %s (%s)", e.Option, e.Reason, e.Source)
+	default:
+		return fmt.Sprintf("%s: %s", e.Option, e.Reason)
+	}
+}
+
+// FileUnreadableError is returned when a config file exists, but can not be
+// read, like when permissions are lacking, the path is a directory or it is a
+// dangling symbolic link.
+type FileUnreadableError struct {
+	// Path is the path of the config file.
+	Path string
+	// SelectedBy is what selected the path: SourceFlag or SourceEnv for the
+	// flag or environment variable of Conf.ConfigFileVariable, or
+	// SourceDefault for the default config files.
+	SelectedBy Source
+	// Err is the error from checking or reading the file.
+	Err error
+}
+
+func (e *FileUnreadableError) Error() string {
+	return fmt.Sprintf("can not read config file at %s (selected by %s): %s",
+		e.Path, e.SelectedBy, e.Err)
+}
+
+// Unwrap returns the error from checking or reading the file.
+func (e *FileUnreadableError) Unwrap() error {
+	return e.Err
+}
+
+// FileNotFoundError is returned when a config file that was explicitly
+// provided does not exist, or when no default config file could be found while
+// Conf.FileRequired is set.
+type FileNotFoundError struct {
+	// Paths are the paths that have been tried.
+	Paths []string
+}
+
+func (e *FileNotFoundError) Error() string {
+	if len(e.Paths) == 1 {
+		return fmt.Sprintf("config file at %s does not exist", e.Paths[0])
+	}
+	return fmt.Sprintf("no config file found, tried: [%s]",
+		strings.Join(e.Paths, ", "))
+}
+
+// Unwrap returns os.ErrNotExist, so that errors.Is(err, os.ErrNotExist) holds.
+func (e *FileNotFoundError) Unwrap() error {
+	return os.ErrNotExist
+}
+
+// SourceError is returned when a source fails as a whole rather than for a
+// single config variable, like when the command line flags can not be parsed
+// or a remote source like the cloud metadata service can not be reached.
+type SourceError struct {
+	// Source is the source that failed.
+	Source Source
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
 // parseError returns a nicely formatted error indicating that we failed to
 // parse v into type t.
 func parseError(v string, t reflect.Type, err error) error {
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The exit codes returned by ExitCode for the classes of errors returned by
+// Load.  They follow the conventions of sysexits.h.
+const (
+	// ExitOK is the exit code for no error.
+	ExitOK = 0
+	// ExitError is the exit code for errors that do not belong to any of the
+	// other classes.
+	ExitError = 1
+	// ExitUsage is the exit code for invalid command line flags.
+	ExitUsage = 64
+	// ExitNoInput is the exit code for config files that do not exist or can
+	// not be read.
+	ExitNoInput = 66
+	// ExitUnavailable is the exit code for remote sources that failed, like
+	// the cloud metadata service or DNS.
+	ExitUnavailable = 69
+	// ExitConfig is the exit code for missing required config variables and
+	// invalid values from sources other than the command line flags.
+	ExitConfig = 78
+)
+
+// isUsageError returns whether the error is caused by the command line flags.
+func isUsageError(err error) bool {
+	var sourceErr *SourceError
+	var parseErr *ParseError
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &sourceErr):
+		return sourceErr.Source == SourceFlag
+	case errors.As(err, &parseErr):
+		return parseErr.Source == SourceFlag
+	case errors.As(err, &validationErr):
+		return validationErr.Source == SourceFlag
+	}
+	return false
+}
+
+// ExitCode returns the conventional exit code for an error returned by Load,
+// based on its class.
+func ExitCode(err error) int {
+	var notFoundErr *FileNotFoundError
+	var unreadableErr *FileUnreadableError
+	var sourceErr *SourceError
+	var parseErr *ParseError
+	var validationErr *ValidationError
+	switch {
+	case err == nil:
+		return ExitOK
+	case isUsageError(err):
+		return ExitUsage
+	case errors.As(err, &notFoundErr), errors.As(err, &unreadableErr):
+		return ExitNoInput
+	case errors.As(err, &sourceErr):
+		return ExitUnavailable
+	case errors.Is(err, ErrMissingRequired), errors.Is(err, ErrEmptyFile),
+		errors.As(err, &parseErr), errors.As(err, &validationErr):
+		return ExitConfig
+	}
+	return ExitError
+}
+
+// writeError writes the error message for the error, prefixed with the name
+// of the program.  Usage errors are followed by a hint to the help message.
+func writeError(w io.Writer, err error) {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(w, "%s: %s\n", name, err)
+	if isUsageError(err) {
+		fmt.Fprintf(w, "Run '%s --help' for usage.\n", name)
+	}
+}
+
+// Exit prints the error returned by Load to stderr and exits with the exit code
+// returned by ExitCode.  It does nothing when the error is nil, so that it can
+// be called directly with the result of Load:
+//
+//	gonfig.Exit(gonfig.Load(&config, gonfig.Conf{}))
+func Exit(err error) {
+	if err == nil {
+		return
+	}
+	writeError(os.Stderr, err)
+	os.Exit(ExitCode(err))
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// compileFallbacks resolves the options referred to by the fallback tags of all
+// options and checks that there are no cycles.
+func compileFallbacks(allOpts []*option) error {
+	byID := optionsByID(allOpts)
+
+	for _, opt := range allOpts {
+		if opt.fallback == "" {
+			continue
+		}
+
+		target, ok := lookupRelative(byID, opt, opt.fallback)
+		if !ok {
+			return fmt.Errorf("unknown fallback config variable for %s: %s",
+				opt.fullID(), opt.fallback)
+		}
+		if opt.isParent || target.isParent {
+			return fmt.Errorf("fallback not supported for nested config "+
+				"variable %s", opt.fullID())
+		}
+		if target.value.Type() != opt.value.Type() {
+			return fmt.Errorf("type of fallback config variable %s (%s) "+
+				"differs from type of %s (%s)", target.fullID(),
+				target.value.Type(), opt.fullID(), opt.value.Type())
+		}
+		opt.fallbackOpt = target
+	}
+
+	// Detect cycles by following the fallback chain of every option.
+	for _, opt := range allOpts {
+		chain := []string{opt.fullID()}
+		for next := opt.fallbackOpt; next != nil; next = next.fallbackOpt {
+			chain = append(chain, next.fullID())
+			if next == opt {
+				return fmt.Errorf("fallback cycle detected: %s",
+					strings.Join(chain, " -> "))
+			}
+			if len(chain) > len(allOpts) {
+				// A cycle that does not include opt, it will be found
+				// from one of the options in the cycle.
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveFallback sets the value of the option to a copy of the resolved value
+// of its fallback option if it has not been set by any source.  The default
+// value of the option takes precedence over the value of its fallback option
+// when that has not been set by any source either.
+func resolveFallback(opt *option, resolved map[*option]bool) error {
+	if resolved[opt] || opt.fallbackOpt == nil || opt.source != "" {
+		return nil
+	}
+	resolved[opt] = true
+
+	target := opt.fallbackOpt
+	if err := resolveFallback(target, resolved); err != nil {
+		return err
+	}
+
+	if opt.defaultSet && target.source == "" {
+		return nil
+	}
+
+	opt.value.Set(copyValue(target.value))
+	normalize(opt)
+	if err := validate(opt); err != nil {
+		return err
+	}
+	opt.source = target.source
+	return nil
+}
+
+// resolveFallbacks sets all options that have a fallback option and that have
+// not been set by any source to the resolved value of their fallback option.
+func resolveFallbacks(s *setup) error {
+	resolved := make(map[*option]bool)
+	for _, opt := range s.allOpts {
+		if err := resolveFallback(opt, resolved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
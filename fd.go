@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// fdContents caches the content read from every file descriptor, as they can
+// only be read once.  The entries are kept until ForgetFDSource is called.
+var fdContents = struct {
+	sync.Mutex
+	m map[int]*fdContent
+}{m: make(map[int]*fdContent)}
+
+// fdContent is the content read from a file descriptor.  done is closed when
+// the file descriptor has been read.
+type fdContent struct {
+	done    chan struct{}
+	content []byte
+	err     error
+}
+
+// readFD reads the content of the file descriptor until EOF and closes it.
+// The result is cached, so that later calls for the same file descriptor
+// return the same result.  It returns early with the error of the context
+// when it is done before the file descriptor is read; the file descriptor is
+// still read in the background for later calls.
+func readFD(ctx context.Context, fd int) ([]byte, error) {
+	fdContents.Lock()
+	c, ok := fdContents.m[fd]
+	if !ok {
+		c = &fdContent{done: make(chan struct{})}
+		fdContents.m[fd] = c
+		go c.read(fd)
+	}
+	fdContents.Unlock()
+
+	select {
+	case <-c.done:
+		return c.content, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ForgetFDSource drops the content read from the file descriptor with
+// Conf.FDSource, so that it is no longer kept in memory.  As the file
+// descriptor is closed after it has been read, the operating system can reuse
+// its number for another file; call ForgetFDSource before loading from a new
+// file descriptor with the same number, or the old content is used again.
+func ForgetFDSource(fd int) {
+	fdContents.Lock()
+	defer fdContents.Unlock()
+
+	delete(fdContents.m, fd)
+}
+
+// read reads the content of the file descriptor and closes it.
+func (c *fdContent) read(fd int) {
+	defer close(c.done)
+
+	file := os.NewFile(uintptr(fd), "gonfig-fd")
+	if file == nil {
+		c.err = fmt.Errorf("invalid file descriptor: %d", fd)
+		return
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		c.err = fmt.Errorf("error reading from file descriptor %d: %s", fd, err)
+		return
+	}
+	c.content = content
+}
+
+// parseFD reads key=value pairs from the file descriptor configured in the
+// Conf and writes the values that have been found in place.  The keys are the
+// full IDs of the options.
+func parseFD(s *setup) error {
+	content, err := readFD(s.ctx, s.conf.FDSource)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*option)
+	for _, opt := range s.allOpts {
+		if !opt.isParent {
+			byID[opt.fullID()] = opt
+		}
+	}
+
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid line %d from file descriptor %d: "+
+				"expected key=value", i+1, s.conf.FDSource)
+		}
+
+		opt, ok := byID[strings.TrimSpace(parts[0])]
+		if !ok {
+			return fmt.Errorf("unknown config variable from file descriptor "+
+				"%d: %s", s.conf.FDSource, parts[0])
+		}
+
+		value, err := resolveSecret(s, opt, strings.TrimSpace(parts[1]))
+		if err != nil {
+			return err
+		}
+
+		before := opt.value.Interface()
+		if err := opt.setValueByString(value); err != nil {
+			return newParseError(opt, SourceFD, value, err)
+		}
+		if err := sourceSet(s, opt, SourceFD, before); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
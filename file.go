@@ -5,34 +5,80 @@
 package gonfig
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
 )
 
 // parseMapOpts parses options from a map[string]interface{}.  This is used
-// for configuration file encodings that can decode to such a map.
-func parseMapOpts(j map[string]interface{}, opts []*option) error {
+// for configuration file encodings that can decode to such a map.  The source
+// is the source the map originates from.
+func parseMapOpts(s *setup, j map[string]interface{}, opts []*option, source Source) error {
 	for _, opt := range opts {
 		val, set := j[opt.id]
-		if !set {
+		for _, alias := range opt.aliases {
+			if set {
+				break
+			}
+			if val, set = j[alias]; set {
+				warn(s, "config key %s (from %s) is deprecated, use %s instead",
+					aliasFullID(opt, alias), source, opt.fullID())
+			}
+		}
+		if !set || val == nil {
+			// Null values are treated like absent ones.
 			continue
 		}
 
-		if opt.isParent {
+		if opt.elemType != nil {
+			if err := parseMapElems(s, opt, val, source); err != nil {
+				return err
+			}
+		} else if opt.isParent {
 			if casted, ok := val.(map[string]interface{}); ok {
-				if err := parseMapOpts(casted, opt.subOpts); err != nil {
+				if err := parseMapOpts(s, casted, opt.subOpts, source); err != nil {
 					return err
 				}
 			} else {
-				return fmt.Errorf("error parsing config file: "+
+				return fmt.Errorf("error parsing %s: "+
 					"value of type %s given for composite config var %s",
-					reflect.TypeOf(val), opt.fullID())
+					source, reflect.TypeOf(val), opt.fullID())
 			}
 		} else {
+			// References to secrets are strings of any type of config var.
+			if source == SourceFile && s.conf.FileStrictTypes &&
+				(!opt.secret || s.conf.SecretResolver == nil) {
+				if err := checkStrictType(opt, val); err != nil {
+					parseErr := newParseError(opt, source, fmt.Sprint(val), err)
+					parseErr.Err = err // Does not contain secret values.
+					return parseErr
+				}
+			}
+
+			if ref, ok := val.(string); ok {
+				resolved, err := resolveSecret(s, opt, ref)
+				if err != nil {
+					return err
+				}
+				val = resolved
+			}
+
+			before := opt.value.Interface()
 			if err := opt.setValue(reflect.ValueOf(val)); err != nil {
+				return newParseError(opt, source, fmt.Sprint(val), err)
+			}
+			if err := sourceSet(s, opt, source, before); err != nil {
 				return err
 			}
 		}
@@ -41,18 +87,300 @@ func parseMapOpts(j map[string]interface{}, opts []*option) error {
 	return nil
 }
 
-// parseFileContent parses the config file given its content.
-func parseFileContent(s *setup, content []byte) error {
+// unknownKeys returns the full keys of all the entries in the map that do not
+// correspond to an option, recursing into nested options.  Nested keys are
+// joined by dots.
+func unknownKeys(j map[string]interface{}, opts []*option, prefix string) []string {
+	byID := make(map[string]*option, len(opts))
+	for _, opt := range opts {
+		byID[opt.id] = opt
+		for _, alias := range opt.aliases {
+			byID[alias] = opt
+		}
+	}
+
+	var unknown []string
+	for key, val := range j {
+		opt, ok := byID[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+
+		if casted, ok := val.(map[string]interface{}); ok && opt.isParent {
+			unknown = append(unknown,
+				unknownKeys(casted, opt.subOpts, prefix+key+".")...)
+		}
+		if list, ok := val.([]interface{}); ok && opt.elemType != nil {
+			for i, item := range list {
+				if casted, ok := item.(map[string]interface{}); ok {
+					unknown = append(unknown, unknownKeys(casted, opt.elemOpts,
+						fmt.Sprintf("%s%s[%d].", prefix, key, i))...)
+				}
+			}
+		}
+	}
+
+	return unknown
+}
+
+// checkUnknownKeys reports the keys in the decoded config file that do not
+// correspond to an option, either by returning an error or by calling the
+// warning function.
+func checkUnknownKeys(s *setup, m map[string]interface{}) error {
+	if !s.conf.FileStrictUnknownKeys && s.conf.UnknownKeyWarning == nil {
+		return nil
+	}
+
+	// When loading a section, only the keys in the section are checked, as the
+	// other keys belong to other sections.
+	opts, prefix := s.opts, ""
+	if s.section != "" {
+		for _, id := range strings.Split(s.section, ".") {
+			sub, ok := m[id].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			m, opts, prefix = sub, opts[0].subOpts, prefix+id+"."
+		}
+	}
+
+	unknown := unknownKeys(m, opts, prefix)
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	if s.conf.FileStrictUnknownKeys {
+		return fmt.Errorf("unknown keys in config file at %s: [%s]",
+			s.configFilePath, strings.Join(unknown, ", "))
+	}
+
+	for _, key := range unknown {
+		s.conf.UnknownKeyWarning(key)
+	}
+	return nil
+}
+
+// KeyNormalizerCaseInsensitive is a Conf.FileKeyNormalizer that matches the
+// keys in the config file case-insensitively.
+func KeyNormalizerCaseInsensitive(key string) string {
+	return strings.ToLower(key)
+}
+
+// KeyNormalizerRelaxed is a Conf.FileKeyNormalizer that matches the keys in
+// the config file case-insensitively and ignores dashes and underscores, so
+// that "maxConnections", "max_connections" and "max-connections" all match
+// the ID "maxconnections".
+func KeyNormalizerRelaxed(key string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(key))
+}
+
+// normalizeFileKeys renames the keys in the decoded config file that match the
+// ID or an alias of an option after applying the normalizer to both, so that
+// they are picked up like exact matches.  Nested options are handled
+// recursively.
+func normalizeFileKeys(normalizer func(string) string, m map[string]interface{}, opts []*option) error {
+	type target struct {
+		opt *option
+		key string
+	}
+	targets := make(map[string]target)
+	for _, opt := range opts {
+		targets[normalizer(opt.id)] = target{opt, opt.id}
+		for _, alias := range opt.aliases {
+			targets[normalizer(alias)] = target{opt, alias}
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	matched := make(map[string]string)
+	for _, key := range keys {
+		t, ok := targets[normalizer(key)]
+		if !ok {
+			continue
+		}
+		if other, ok := matched[t.key]; ok {
+			id := t.opt.fullID()
+			if t.key != t.opt.id {
+				id = aliasFullID(t.opt, t.key)
+			}
+			return fmt.Errorf("config file keys %s and %s both match %s",
+				other, key, id)
+		}
+		matched[t.key] = key
+	}
+
+	for key, original := range matched {
+		if key != original {
+			m[key] = m[original]
+			delete(m, original)
+		}
+	}
+
+	for key := range matched {
+		opt := targets[normalizer(key)].opt
+		if sub, ok := m[key].(map[string]interface{}); ok && opt.isParent {
+			if err := normalizeFileKeys(normalizer, sub, opt.subOpts); err != nil {
+				return err
+			}
+		}
+		if list, ok := m[key].([]interface{}); ok && opt.elemType != nil {
+			for _, item := range list {
+				if sub, ok := item.(map[string]interface{}); ok {
+					if err := normalizeFileKeys(normalizer, sub, opt.elemOpts); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// EmptyFileAction specifies how an empty config file is handled.
+type EmptyFileAction int
+
+const (
+	// EmptyFileIgnore ignores empty config files.
+	EmptyFileIgnore EmptyFileAction = iota
+	// EmptyFileWarn ignores empty config files, but passes a warning to
+	// Conf.WarnFunc.
+	EmptyFileWarn
+	// EmptyFileError makes loading an empty config file fail.
+	EmptyFileError
+)
+
+// handleEmptyFile handles an empty config file according to the Conf.
+func handleEmptyFile(s *setup) error {
+	name := "config file"
+	if s.configFilePath != "" {
+		name = "config file at " + s.configFilePath
+	}
+
+	switch s.conf.FileEmpty {
+	case EmptyFileWarn:
+		warn(s, "%s is empty", name)
+	case EmptyFileError:
+		return fmt.Errorf("%w: %s", ErrEmptyFile, name)
+	}
+	return nil
+}
+
+// The byte order marks of the supported text encodings.
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// toUTF8 converts config file content that starts with a byte order mark to
+// UTF-8 without byte order mark.  Both UTF-8 and UTF-16 content with a byte
+// order mark, as often written by editors on Windows, are supported.  Other
+// content is returned as is.
+func toUTF8(content []byte) ([]byte, error) {
+	if bytes.HasPrefix(content, bomUTF8) {
+		return content[len(bomUTF8):], nil
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(content, bomUTF16LE):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(content, bomUTF16BE):
+		order = binary.BigEndian
+	default:
+		return content, nil
+	}
+
+	content = content[2:]
+	if len(content)%2 != 0 {
+		return nil, errors.New("invalid UTF-16 content: odd number of bytes")
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+	return []byte(string(utf16.Decode(units))), nil
+}
+
+// decodeFileContent decodes the content of the config file and checks it for
+// unknown keys.  Empty files decode to a nil map.
+func decodeFileContent(s *setup, content []byte) (map[string]interface{}, error) {
+	defer timePhase(s, PhaseFileDecode, time.Now())
+
+	m, err := decodeContent(s, content, s.opts)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	if s.conf.FileIncludeKey != "" {
+		if m, err = resolveIncludes(s, m, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if fileProfilesEnabled(s.conf) {
+		if m, err = applyFileProfiles(s, m); err != nil {
+			return nil, err
+		}
+	}
+
+	applyAliasTable(s, m)
+
+	if s.conf.FileKeyNormalizer != nil {
+		if err := normalizeFileKeys(s.conf.FileKeyNormalizer, m, s.opts); err != nil {
+			return nil, fmt.Errorf("error in config file at %s: %s",
+				s.configFilePath, err)
+		}
+	}
+
+	if err := resolveSectionFiles(s, m, s.opts); err != nil {
+		return nil, err
+	}
+	unmarkSectionFiles(m)
+
+	if err := checkUnknownKeys(s, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// decodeContent decodes the content of the config file at s.configFilePath
+// with the options opts.  Empty files decode to a nil map.
+func decodeContent(s *setup, content []byte, opts []*option) (map[string]interface{}, error) {
+	content, err := toUTF8(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file at %s: %s",
+			s.configFilePath, err)
+	}
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		// Decoders disagree on empty content, so handle it up front.
+		return nil, handleEmptyFile(s)
+	}
+
 	decoder := s.conf.FileDecoder
 	if decoder == nil {
 		// Look for the config file extension to determine the encoding.
-		switch path.Ext(s.configFilePath) {
-		case "json":
+		switch strings.ToLower(path.Ext(s.configFilePath)) {
+		case ".json":
 			decoder = DecoderJSON
-		case "toml":
+		case ".toml":
 			decoder = DecoderTOML
-		case "yaml", "yml":
+		case ".yaml", ".yml":
 			decoder = DecoderYAML
+		case ".hcl":
+			decoder = DecoderHCL
+		case ".ini", ".cfg":
+			decoder = DecoderINI
 		default:
 			decoder = DecoderTryAll
 		}
@@ -60,38 +388,478 @@ func parseFileContent(s *setup, content []byte) error {
 
 	m, err := decoder(content)
 	if err != nil {
-		return fmt.Errorf("failed to parse file at %s: %s",
+		return nil, fmt.Errorf("failed to parse file at %s: %s",
 			s.configFilePath, err)
 	}
 
-	// Parse the map for the options.
-	if err := parseMapOpts(m, s.opts); err != nil {
-		return fmt.Errorf("error loading config vars from config file: %s", err)
+	mergeFileBlocks(s, m, opts)
+	markSectionFiles(s, m)
+	return m, nil
+}
+
+// mergeFileBlocks merges the blocks in the decoded config file m with the
+// options opts using mergeBlocks, including those in config file profiles.
+func mergeFileBlocks(s *setup, m map[string]interface{}, opts []*option) {
+	if fileProfilesEnabled(s.conf) {
+		for key, val := range m {
+			if blockOption(s, key, opts) == nil {
+				m[key] = mergeBlocks(s, val, opts)
+			}
+		}
+	}
+	mergeBlocks(s, m, opts)
+}
+
+// sectionFilePrefix marks the values in config files that refer to a file
+// with the content of a section.  The YAML decoder turns values with the
+// !include tag into such values.
+const sectionFilePrefix = "file://"
+
+// sectionFile is a value in a decoded config file that refers to a file with
+// the content of a section.  The values are marked when the file is decoded,
+// to remember the file they are relative to, and resolved once the decoded
+// config files have been merged and their keys normalized.
+type sectionFile struct {
+	filename string // The path of the file, relative to the declaring file.
+	value    string // The value in the config file.
+}
+
+// markSectionFiles replaces the strings with the section file prefix in the
+// decoded config file at s.configFilePath with sectionFile values.
+func markSectionFiles(s *setup, v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = markSectionFiles(s, val)
+		}
+
+	case []interface{}:
+		for i, val := range v {
+			v[i] = markSectionFiles(s, val)
+		}
+
+	case string:
+		if !strings.HasPrefix(v, sectionFilePrefix) {
+			return v
+		}
+		filename := strings.TrimPrefix(v, sectionFilePrefix)
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(filepath.Dir(s.configFilePath), filename)
+		}
+		return sectionFile{filename, v}
+	}
+	return v
+}
+
+// unmarkSectionFiles replaces the sectionFile values that have not been
+// resolved, as they are not given for nested options, with their original
+// value.
+func unmarkSectionFiles(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = unmarkSectionFiles(val)
+		}
+
+	case []interface{}:
+		for i, val := range v {
+			v[i] = unmarkSectionFiles(val)
+		}
+
+	case sectionFile:
+		return v.value
+	}
+	return v
+}
+
+// resolveSectionFiles replaces the values given for nested options in the
+// decoded config file that refer to a file with the decoded content of that
+// file, relative to the config file that declared the value.  This allows
+// splitting sections into separate files, like "tls: !include tls.yaml" in
+// YAML or "tls": "file://tls.json" in JSON.  The elements of lists of structs
+// can refer to a file as well, like "- !include server.yaml".  Other strings
+// are left as they are and cause an error when the options are parsed.
+func resolveSectionFiles(s *setup, m map[string]interface{}, opts []*option) error {
+	for _, opt := range opts {
+		if !opt.isParent && opt.elemType == nil {
+			continue
+		}
+
+		for _, key := range append([]string{opt.id}, opt.aliases...) {
+			if opt.elemType != nil {
+				list, ok := m[key].([]interface{})
+				if !ok {
+					continue
+				}
+				for i, item := range list {
+					id := fmt.Sprintf("%s[%d]", opt.fullID(), i)
+					elem, err := resolveSectionFile(s, id, item, opt.elemOpts)
+					if err != nil {
+						return err
+					}
+					list[i] = elem
+				}
+				continue
+			}
+
+			val, err := resolveSectionFile(s, opt.fullID(), m[key], opt.subOpts)
+			if err != nil {
+				return err
+			}
+			if val != nil {
+				m[key] = val
+			}
+		}
 	}
 
 	return nil
 }
 
-// parseFile parses the config file for all config options by delegating
-// the call to the method specific to the config file encoding specified.
-func parseFile(s *setup) error {
-	if _, err := os.Stat(s.configFilePath); os.IsNotExist(err) {
+// resolveSectionFile returns the value for the nested option with the given
+// full ID, with the options opts, after resolving the section files in it.
+func resolveSectionFile(s *setup, id string, val interface{}, opts []*option) (interface{}, error) {
+	switch val := val.(type) {
+	case map[string]interface{}:
+		return val, resolveSectionFiles(s, val, opts)
+
+	case sectionFile:
+		return decodeSectionFile(s, id, val.filename, opts)
+	}
+	return val, nil
+}
+
+// decodeSectionFile decodes the file with the content of the section for the
+// nested option with the given full ID and the options opts.
+func decodeSectionFile(s *setup, id string, filename string, opts []*option) (map[string]interface{}, error) {
+	parent := s.configFilePath
+	content, err := readFile(s.ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file at %s for %s "+
+			"from %s: %s", filename, id, parent, err)
+	}
+
+	s.configFilePath = filename
+	defer func() { s.configFilePath = parent }()
+
+	section, err := decodeContent(s, content, opts)
+	if err != nil {
+		return nil, err
+	}
+	if section == nil {
+		section = make(map[string]interface{})
+	}
+
+	if s.conf.FileKeyNormalizer != nil {
+		if err := normalizeFileKeys(s.conf.FileKeyNormalizer, section, opts); err != nil {
+			return nil, fmt.Errorf("error in config file at %s: %s",
+				filename, err)
+		}
+	}
+	return section, resolveSectionFiles(s, section, opts)
+}
+
+// maxIncludeDepth is the maximum depth of nested includes in config files.
+const maxIncludeDepth = 10
+
+// resolveIncludes loads the files listed under Conf.FileIncludeKey in the
+// decoded config file at s.configFilePath and merges them, in order, with the
+// content of the file itself on top.  Relative paths are relative to the
+// directory of the including file.  Included files can include other files;
+// the stack holds the paths of the files including the current one.
+func resolveIncludes(s *setup, m map[string]interface{}, stack []string) (map[string]interface{}, error) {
+	val, ok := m[s.conf.FileIncludeKey]
+	if !ok {
+		return m, nil
+	}
+	delete(m, s.conf.FileIncludeKey)
+
+	parent := s.configFilePath
+	var includes []string
+	switch val := val.(type) {
+	case string:
+		includes = []string{val}
+	case []interface{}:
+		for _, include := range val {
+			str, ok := include.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid include in config file at %s: "+
+					"value of type %T", parent, include)
+			}
+			includes = append(includes, str)
+		}
+	default:
+		return nil, fmt.Errorf("invalid include in config file at %s: "+
+			"expected a string or a list of strings", parent)
+	}
+
+	stack = append(stack, parent)
+	if len(stack) > maxIncludeDepth {
+		return nil, fmt.Errorf("too many nested includes in config file at "+
+			"%s (the maximum depth is %d)", parent, maxIncludeDepth)
+	}
+
+	merge := s.conf.MergeFunc
+	if merge == nil {
+		merge = deepMerge
+	}
+
+	merged := make(map[string]interface{})
+	defer func() { s.configFilePath = parent }()
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(parent), include)
+		}
+		for _, including := range stack {
+			if including == include {
+				return nil, fmt.Errorf("include cycle in config files: %s",
+					strings.Join(append(stack, include), " -> "))
+			}
+		}
+
+		content, err := readFile(s.ctx, include)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file at %s "+
+				"included from %s: %s", include, parent, err)
+		}
+
+		s.configFilePath = include
+		included, err := decodeContent(s, content, s.opts)
+		if err != nil {
+			return nil, err
+		}
+		if included == nil {
+			continue
+		}
+		if included, err = resolveIncludes(s, included, stack); err != nil {
+			return nil, err
+		}
+		merge(merged, included)
+	}
+
+	merge(merged, m)
+	return merged, nil
+}
+
+// applyFileMap parses the decoded config file for the options.
+func applyFileMap(s *setup, m map[string]interface{}) error {
+	if err := checkFileProfiles(s); err != nil {
+		return err
+	}
+
+	if err := parseMapOpts(s, m, s.opts, SourceFile); err != nil {
+		return fmt.Errorf("error loading config vars from config file: %w", err)
+	}
+
+	return nil
+}
+
+// parseFileContent parses the config file given its content.
+func parseFileContent(s *setup, content []byte) error {
+	m, err := decodeFileContent(s, content)
+	if err != nil {
+		return err
+	}
+
+	return applyFileMap(s, m)
+}
+
+// decodeFile reads and decodes the config file.  If the file does not exist,
+// a nil map is returned, unless it was provided explicitly.
+func decodeFile(s *setup) (map[string]interface{}, error) {
+	unreadable := func(err error) error {
+		return &FileUnreadableError{
+			Path:       s.configFilePath,
+			SelectedBy: s.configFileSource,
+			Err:        err,
+		}
+	}
+
+	info, err := os.Stat(s.configFilePath)
+	if os.IsNotExist(err) {
+		if _, lerr := os.Lstat(s.configFilePath); lerr == nil {
+			// The path is a symbolic link to a file that does not exist.
+			return nil, unreadable(fmt.Errorf("dangling symbolic link: %w", err))
+		}
+
 		// Config file is not present.  We ignore this when we are using
 		// the default config file, but we escalate if the user provided
 		// the config file explicitely.
 		if s.customConfigFile {
-			return fmt.Errorf(
-				"config file at %s does not exist", s.configFilePath)
+			return nil, &FileNotFoundError{Paths: []string{s.configFilePath}}
 		} else {
-			return nil
+			return nil, nil
 		}
 	}
 
-	content, err := ioutil.ReadFile(s.configFilePath)
 	if err != nil {
-		return fmt.Errorf(
-			"error reading config file at %s: %s", s.configFilePath, err)
+		return nil, unreadable(err)
+	}
+	if info.IsDir() {
+		return nil, unreadable(errors.New("path is a directory"))
+	}
+
+	start := time.Now()
+	content, err := readFile(s.ctx, s.configFilePath)
+	timePhase(s, PhaseFileRead, start)
+	if err != nil {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, unreadable(err)
+	}
+
+	return decodeFileContent(s, content)
+}
+
+// parseFile parses the config file for all config options by delegating
+// the call to the method specific to the config file encoding specified.
+func parseFile(s *setup) error {
+	m, err := decodeFile(s)
+	if err != nil {
+		return err
+	}
+
+	return applyFileMap(s, m)
+}
+
+// deepMerge merges src into dst.  Nested maps are merged recursively, all
+// other values in src replace the ones in dst.
+func deepMerge(dst, src map[string]interface{}) {
+	for key, val := range src {
+		srcMap, srcIsMap := val.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			deepMerge(dstMap, srcMap)
+		} else {
+			dst[key] = val
+		}
+	}
+}
+
+// readFile reads the file, but returns early with the error of the context
+// when it is done before the file is read, like for a file on an unresponsive
+// network mount.
+func readFile(ctx context.Context, filename string) ([]byte, error) {
+	type result struct {
+		content []byte
+		err     error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		content, err := ioutil.ReadFile(filename)
+		done <- result{content, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.content, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// defaultFilenames returns all the default config file names in the order in
+// which they should be parsed.
+func defaultFilenames(conf *Conf) []string {
+	var filenames []string
+	if conf.FileDefaultFilename != "" {
+		filenames = append(filenames, conf.FileDefaultFilename)
+	}
+	for _, filename := range conf.FileDefaultFilenames {
+		if filename != "" {
+			filenames = append(filenames, filename)
+		}
+	}
+	return filenames
+}
+
+// userConfigDir returns the directory of the application in the user's config
+// directory, like ~/.config/<app> or %AppData%\<app>, if
+// Conf.FileUseUserConfigDir is set.  It returns an empty string if the user's
+// config directory can not be determined.
+func userConfigDir(conf *Conf) string {
+	if !conf.FileUseUserConfigDir {
+		return ""
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	app := conf.AppName
+	if app == "" {
+		app = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	}
+	return filepath.Join(dir, app)
+}
+
+// searchPaths returns the paths where to look for the default config file
+// with the given name, in order of preference.  The application's directory in
+// the user's config directory comes first, if enabled.
+func searchPaths(conf *Conf, filename string) []string {
+	if filepath.IsAbs(filename) {
+		return []string{filename}
+	}
+
+	var paths []string
+	if dir := userConfigDir(conf); dir != "" {
+		paths = append(paths, filepath.Join(dir, filename))
+	}
+	if len(conf.FileSearchPaths) == 0 {
+		return append(paths, filename)
+	}
+	for _, dir := range conf.FileSearchPaths {
+		paths = append(paths, filepath.Join(os.ExpandEnv(dir), filename))
+	}
+	return paths
+}
+
+// parseDefaultFiles parses all the default config files that exist in order,
+// so that values in later files override those in earlier ones.  The decoded
+// files are merged using Conf.MergeFunc before the values are written in place.
+// Every default file is looked for in all search paths and only the first one
+// found is used.
+func parseDefaultFiles(s *setup) error {
+	merge := s.conf.MergeFunc
+	if merge == nil {
+		merge = deepMerge
+	}
+
+	var tried []string
+	merged := make(map[string]interface{})
+	found := false
+	for _, filename := range defaultFilenames(s.conf) {
+		for _, candidate := range searchPaths(s.conf, filename) {
+			absPath, err := filepath.Abs(candidate)
+			if err != nil {
+				return fmt.Errorf("failed to convert default config file "+
+					"location to an absolute path: %s", err)
+			}
+
+			tried = append(tried, absPath)
+			if _, err := os.Lstat(absPath); os.IsNotExist(err) {
+				continue
+			}
+
+			s.configFilePath = absPath
+			m, err := decodeFile(s)
+			if err != nil {
+				return err
+			}
+			if m != nil {
+				merge(merged, m)
+			}
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		if s.conf.FileRequired {
+			return &FileNotFoundError{Paths: tried}
+		}
+		return nil
 	}
 
-	return parseFileContent(s, content)
+	return applyFileMap(s, merged)
 }
@@ -5,20 +5,28 @@
 package gonfig
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestParseFile_FileNotExist_Default(t *testing.T) {
 	require.NoError(t, parseFile(&setup{
+		ctx:            context.Background(),
 		configFilePath: "/doesntexist.conf",
 	}))
 }
 
 func TestParseFile_FileNotExist_Custom(t *testing.T) {
 	require.Error(t, parseFile(&setup{
+		ctx:              context.Background(),
 		configFilePath:   "/doesntexist.conf",
 		customConfigFile: true,
 	}))
@@ -34,6 +42,7 @@ func TestParseFile_InvalidJSON(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Error(t, parseFile(&setup{
+		ctx:            context.Background(),
 		configFilePath: file.Name(),
 		conf: &Conf{
 			FileDecoder: DecoderJSON,
@@ -49,6 +58,7 @@ func TestParseFile_InvalidYAML(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Error(t, parseFile(&setup{
+		ctx:            context.Background(),
 		configFilePath: file.Name(),
 		conf: &Conf{
 			FileDecoder: DecoderYAML,
@@ -64,6 +74,7 @@ func TestParseFile_InvalidTOML(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Error(t, parseFile(&setup{
+		ctx:            context.Background(),
 		configFilePath: file.Name(),
 		conf: &Conf{
 			FileDecoder: DecoderTOML,
@@ -79,6 +90,7 @@ func TestParseFile_InvalidAny(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Error(t, parseFile(&setup{
+		ctx:            context.Background(),
 		configFilePath: file.Name(),
 		conf: &Conf{
 			FileDecoder: DecoderTryAll,
@@ -94,6 +106,7 @@ func TestParseFile_MultiDecoder(t *testing.T) {
 	require.NoError(t, err)
 
 	require.NoError(t, parseFile(&setup{
+		ctx:            context.Background(),
 		configFilePath: file.Name(),
 		conf: &Conf{
 			FileDecoder: NewMultiFileDecoder([]FileDecoderFn{
@@ -104,3 +117,576 @@ func TestParseFile_MultiDecoder(t *testing.T) {
 		},
 	}))
 }
+
+func TestParseDefaultFiles_Override(t *testing.T) {
+	base, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = base.WriteString(`{"v1": 1, "v2": 1}`)
+	require.NoError(t, err)
+
+	override, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = override.WriteString(`{"v2": 2}`)
+	require.NoError(t, err)
+
+	setOS(nil, nil)
+	config := &struct {
+		V1 int
+		V2 int
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilename: base.Name(),
+		FileDefaultFilenames: []string{
+			"/doesntexist.conf",
+			override.Name(),
+		},
+		FileDecoder: DecoderJSON,
+	}))
+
+	assert.Equal(t, 1, config.V1)
+	assert.Equal(t, 2, config.V2)
+}
+
+func TestParseDefaultFiles_DeepMerge(t *testing.T) {
+	base, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = base.WriteString(`{"db": {"host": "a", "port": 1}, "v": 1}`)
+	require.NoError(t, err)
+
+	override, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = override.WriteString(`{"db": {"port": 2}}`)
+	require.NoError(t, err)
+
+	setOS(nil, nil)
+	config := &struct {
+		DB struct {
+			Host string
+			Port int
+		}
+		V int
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilenames: []string{base.Name(), override.Name()},
+		FileDecoder:          DecoderJSON,
+	}))
+
+	assert.Equal(t, "a", config.DB.Host)
+	assert.Equal(t, 2, config.DB.Port)
+	assert.Equal(t, 1, config.V)
+}
+
+func TestParseDefaultFiles_MergeFunc(t *testing.T) {
+	base, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = base.WriteString(`{"v1": "base", "v2": "base"}`)
+	require.NoError(t, err)
+
+	override, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = override.WriteString(`{"v1": null}`)
+	require.NoError(t, err)
+
+	setOS(nil, nil)
+	config := &struct {
+		V1 string `default:"default"`
+		V2 string
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilenames: []string{base.Name(), override.Name()},
+		FileDecoder:          DecoderJSON,
+		MergeFunc: func(dst, src map[string]interface{}) {
+			for key, val := range src {
+				if val == nil {
+					delete(dst, key)
+				} else {
+					dst[key] = val
+				}
+			}
+		},
+	}))
+
+	assert.Equal(t, "default", config.V1)
+	assert.Equal(t, "base", config.V2)
+}
+
+func TestParseDefaultFiles_SearchPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(
+		path.Join(dir, "app.conf"), []byte(`{"v": 5}`), 0644))
+
+	setOS(nil, map[string]string{"GONFIG_TEST_DIR": dir})
+	config := &struct {
+		V int
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilename: "app.conf",
+		FileSearchPaths:     []string{"/doesntexist", "$GONFIG_TEST_DIR"},
+		FileDecoder:         DecoderJSON,
+		FileRequired:        true,
+	}))
+
+	assert.Equal(t, 5, config.V)
+}
+
+func TestParseDefaultFiles_UserConfigDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG_CONFIG_HOME is only used on Linux")
+	}
+
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(path.Join(dir, "myapp"), 0755))
+	require.NoError(t, ioutil.WriteFile(
+		path.Join(dir, "myapp", "app.conf"), []byte(`{"v": 5}`), 0644))
+
+	setOS(nil, map[string]string{"XDG_CONFIG_HOME": dir})
+	config := &struct {
+		V int
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilename:  "app.conf",
+		FileSearchPaths:      []string{"/doesntexist"},
+		FileUseUserConfigDir: true,
+		AppName:              "myapp",
+		FileDecoder:          DecoderJSON,
+		FileRequired:         true,
+	}))
+	assert.Equal(t, 5, config.V)
+
+	err = Load(config, Conf{
+		FileDefaultFilename:  "app.conf",
+		FileUseUserConfigDir: true,
+		AppName:              "otherapp",
+		FileRequired:         true,
+	})
+	var notFound *FileNotFoundError
+	require.True(t, errors.As(err, &notFound))
+	assert.Equal(t, path.Join(dir, "otherapp", "app.conf"), notFound.Paths[0])
+	assert.Len(t, notFound.Paths, 2)
+}
+
+func TestParseDefaultFiles_Required(t *testing.T) {
+	setOS(nil, nil)
+	err := Load(&struct{ V int }{}, Conf{
+		FileDefaultFilename: "app.conf",
+		FileSearchPaths:     []string{"/doesntexist1", "/doesntexist2"},
+		FileRequired:        true,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "/doesntexist1/app.conf")
+	assert.Contains(t, err.Error(), "/doesntexist2/app.conf")
+
+	var notFound *FileNotFoundError
+	require.True(t, errors.As(err, &notFound))
+	assert.Equal(t, []string{
+		"/doesntexist1/app.conf", "/doesntexist2/app.conf"}, notFound.Paths)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestParseFileContent_KeyNormalizer(t *testing.T) {
+	content := []byte(`{"maxConnections": 1, "Nested": {"inner_value": 2}}`)
+	config := &struct {
+		MaxConnections int
+		Nested         struct {
+			InnerValue int
+		}
+	}{}
+
+	require.NoError(t, LoadRawFile(config, content, Conf{
+		FileDecoder:           DecoderJSON,
+		FileKeyNormalizer:     KeyNormalizerRelaxed,
+		FileStrictUnknownKeys: true,
+	}))
+	assert.Equal(t, 1, config.MaxConnections)
+	assert.Equal(t, 2, config.Nested.InnerValue)
+
+	content = []byte(`{"max_connections": 1, "max-connections": 2}`)
+	err := LoadRawFile(config, content, Conf{
+		FileDecoder:       DecoderJSON,
+		FileKeyNormalizer: KeyNormalizerRelaxed,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max-connections and max_connections")
+
+	content = []byte(`{"max_connections": 3}`)
+	require.NoError(t, LoadRawFile(config, content, Conf{
+		FileDecoder:       DecoderJSON,
+		FileKeyNormalizer: KeyNormalizerCaseInsensitive,
+	}))
+	assert.Equal(t, 1, config.MaxConnections)
+}
+
+func TestParseFileContent_UnknownKeys(t *testing.T) {
+	content := []byte(`{"port": 1, "prot": 2, "nested": {"inner": 3, "iner": 4}}`)
+	config := &struct {
+		Port   int
+		Nested struct {
+			Inner int
+		}
+	}{}
+
+	err := LoadRawFile(config, content, Conf{
+		FileDecoder:           DecoderJSON,
+		FileStrictUnknownKeys: true,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "[nested.iner, prot]")
+
+	var warnings []string
+	require.NoError(t, LoadRawFile(config, content, Conf{
+		FileDecoder: DecoderJSON,
+		UnknownKeyWarning: func(key string) {
+			warnings = append(warnings, key)
+		},
+	}))
+	assert.Equal(t, []string{"nested.iner", "prot"}, warnings)
+	assert.Equal(t, 3, config.Nested.Inner)
+}
+
+func TestParseFile_InvalidINI(t *testing.T) {
+	file, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+
+	_, err = file.WriteString("[section\nkey = value\n")
+	require.NoError(t, err)
+
+	require.Error(t, parseFile(&setup{
+		ctx:            context.Background(),
+		configFilePath: file.Name(),
+		conf: &Conf{
+			FileDecoder: DecoderINI,
+		},
+	}))
+}
+
+func TestParseFile_InvalidHCL(t *testing.T) {
+	file, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+
+	_, err = file.WriteString("nested {\nkey = \"value\"\n")
+	require.NoError(t, err)
+
+	require.Error(t, parseFile(&setup{
+		ctx:            context.Background(),
+		configFilePath: file.Name(),
+		conf: &Conf{
+			FileDecoder: DecoderHCL,
+		},
+	}))
+}
+
+func TestParseFile_DecoderFromExtension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+
+	for name, content := range map[string]string{
+		"config.ini": "[nested]\nv = 5\n",
+		"config.hcl": "nested {\n  v = 5\n}\n",
+	} {
+		filename := path.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(filename, []byte(content), 0644))
+
+		config := &struct {
+			Nested struct {
+				V int
+			}
+		}{}
+		s := &setup{ctx: context.Background(), conf: &Conf{}, configFilePath: filename}
+		require.NoError(t, inspectConfigStructure(s, config), name)
+		require.NoError(t, parseFile(s), name)
+		assert.Equal(t, 5, config.Nested.V, name)
+	}
+}
+
+func TestParseFile_HCLBlocks(t *testing.T) {
+	config := &struct {
+		Nested struct {
+			V int
+			W int
+		}
+		Servers []struct {
+			Name string
+			TLS  struct {
+				Cert string
+			}
+		}
+	}{}
+
+	s := &setup{ctx: context.Background(), conf: &Conf{FileDecoder: DecoderHCL}}
+	require.NoError(t, inspectConfigStructure(s, config))
+	require.NoError(t, parseFileContent(s, []byte(
+		"nested {\n  v = 5\n}\n"+
+			"nested {\n  w = 6\n}\n"+
+			"servers {\n  name = \"a\"\n  tls {\n    cert = \"a.pem\"\n  }\n}\n"+
+			"servers {\n  name = \"b\"\n}\n")))
+	assert.Equal(t, 5, config.Nested.V)
+	assert.Equal(t, 6, config.Nested.W)
+	require.Len(t, config.Servers, 2)
+	assert.Equal(t, "a", config.Servers[0].Name)
+	assert.Equal(t, "a.pem", config.Servers[0].TLS.Cert)
+	assert.Equal(t, "b", config.Servers[1].Name)
+	assert.Equal(t, "", config.Servers[1].TLS.Cert)
+
+	s = &setup{ctx: context.Background(), conf: &Conf{
+		FileDecoder: DecoderHCL,
+		Profile:     "dev",
+	}}
+	require.NoError(t, inspectConfigStructure(s, config))
+	require.NoError(t, parseFileContent(s, []byte(
+		"default {\n  nested {\n    v = 1\n  }\n}\n"+
+			"dev {\n  servers {\n    name = \"c\"\n  }\n"+
+			"  servers {\n    name = \"d\"\n  }\n}\n")))
+	assert.Equal(t, 1, config.Nested.V)
+	require.Len(t, config.Servers, 2)
+	assert.Equal(t, "c", config.Servers[0].Name)
+	assert.Equal(t, "d", config.Servers[1].Name)
+}
+
+func TestParseFileContent_Empty(t *testing.T) {
+	config := &struct {
+		V int `default:"1"`
+	}{}
+	for _, decoder := range []FileDecoderFn{DecoderJSON, DecoderTOML, DecoderYAML} {
+		require.NoError(t, LoadRawFile(config, []byte(" \n\t\n"), Conf{
+			FileDecoder: decoder,
+		}))
+		assert.Equal(t, 1, config.V)
+	}
+
+	var warnings []string
+	require.NoError(t, LoadRawFile(config, nil, Conf{
+		FileEmpty: EmptyFileWarn,
+		WarnFunc: func(msg string) {
+			warnings = append(warnings, msg)
+		},
+	}))
+	assert.Equal(t, []string{"config file is empty"}, warnings)
+
+	err := LoadRawFile(config, []byte("\n"), Conf{FileEmpty: EmptyFileError})
+	assert.True(t, errors.Is(err, ErrEmptyFile))
+}
+
+func TestParseFileContent_BOM(t *testing.T) {
+	utf16LE := []byte{0xFF, 0xFE}
+	utf16BE := []byte{0xFE, 0xFF}
+	for _, r := range `{"v": "é"}` {
+		utf16LE = append(utf16LE, byte(r), byte(r>>8))
+		utf16BE = append(utf16BE, byte(r>>8), byte(r))
+	}
+
+	for name, content := range map[string][]byte{
+		"utf-8":    append([]byte{0xEF, 0xBB, 0xBF}, `{"v": "é"}`...),
+		"utf-16le": utf16LE,
+		"utf-16be": utf16BE,
+	} {
+		config := &struct{ V string }{}
+		require.NoError(t, LoadRawFile(config, content, Conf{
+			FileDecoder: DecoderJSON,
+		}), name)
+		assert.Equal(t, "é", config.V, name)
+	}
+
+	err := LoadRawFile(&struct{ V string }{}, []byte{0xFF, 0xFE, '{'}, Conf{
+		FileDecoder: DecoderJSON,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "odd number of bytes")
+}
+
+func TestLoad_FileUnreadable(t *testing.T) {
+	requireFlags(t)
+
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	dangling := path.Join(dir, "dangling.conf")
+	require.NoError(t, os.Symlink(path.Join(dir, "doesntexist"), dangling))
+	unreadable := path.Join(dir, "unreadable.conf")
+	require.NoError(t, ioutil.WriteFile(unreadable, []byte(`{}`), 0))
+
+	type config struct {
+		ConfigFile string
+	}
+	type testCase struct {
+		args       []string
+		env        map[string]string
+		conf       Conf
+		path       string
+		selectedBy Source
+	}
+	cases := []testCase{
+		{[]string{"--configfile", dir}, nil,
+			Conf{ConfigFileVariable: "configfile"}, dir, SourceFlag},
+		{nil, map[string]string{"CONFIGFILE": dangling},
+			Conf{ConfigFileVariable: "configfile"}, dangling, SourceEnv},
+		{nil, nil, Conf{FileDefaultFilename: dangling}, dangling, SourceDefault},
+	}
+	if os.Geteuid() != 0 {
+		// Permissions do not apply to root.
+		cases = append(cases, testCase{nil, nil, Conf{FileDefaultFilename: unreadable}, unreadable,
+			SourceDefault})
+	}
+
+	for _, c := range cases {
+		setOS(c.args, c.env)
+		err := Load(&config{}, c.conf)
+		require.Error(t, err, c.path)
+
+		var fileErr *FileUnreadableError
+		require.True(t, errors.As(err, &fileErr), err.Error())
+		assert.Equal(t, c.path, fileErr.Path)
+		assert.Equal(t, c.selectedBy, fileErr.SelectedBy)
+		assert.Contains(t, err.Error(), "selected by "+string(c.selectedBy))
+	}
+}
+
+func TestParseFile_Include(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(path.Join(dir, "conf.d"), 0755))
+
+	for name, content := range map[string]string{
+		"main.json":           `{"include": ["conf.d/base.json", "conf.d/secrets.json"], "port": 2}`,
+		"conf.d/base.json":    `{"include": "nested.json", "port": 1, "db": {"host": "a"}}`,
+		"conf.d/nested.json":  `{"db": {"user": "nested"}}`,
+		"conf.d/secrets.json": `{"db": {"pass": "secret"}}`,
+		"cycle1.json":         `{"include": "cycle2.json"}`,
+		"cycle2.json":         `{"include": ["cycle1.json"]}`,
+	} {
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, name),
+			[]byte(content), 0644))
+	}
+
+	type Config struct {
+		Port int
+		DB   struct {
+			Host string
+			User string
+			Pass string
+		}
+	}
+
+	setOS(nil, nil)
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilename:   path.Join(dir, "main.json"),
+		FileIncludeKey:        "include",
+		FileStrictUnknownKeys: true,
+	}))
+	assert.Equal(t, 2, config.Port)
+	assert.Equal(t, "a", config.DB.Host)
+	assert.Equal(t, "nested", config.DB.User)
+	assert.Equal(t, "secret", config.DB.Pass)
+
+	err = Load(&Config{}, Conf{
+		FileDefaultFilename: path.Join(dir, "cycle1.json"),
+		FileIncludeKey:      "include",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "include cycle in config files: "+
+		path.Join(dir, "cycle1.json")+" -> "+path.Join(dir, "cycle2.json")+
+		" -> "+path.Join(dir, "cycle1.json"))
+}
+
+func TestParseFile_SectionFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(path.Join(dir, "tls"), 0755))
+
+	for name, content := range map[string]string{
+		"main.yaml":       "port: 1\ntls: !include tls/tls.yaml\ndb: file://db.json\n",
+		"tls/tls.yaml":    "cert: cert.pem\nclient: !include client.yaml\n",
+		"tls/client.yaml": "ca: ca.pem\n",
+		"db.json":         `{"host": "db"}`,
+	} {
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, name),
+			[]byte(content), 0644))
+	}
+
+	setOS(nil, nil)
+	config := &struct {
+		Port int
+		TLS  struct {
+			Cert   string
+			Client struct {
+				CA string
+			}
+		}
+		DB struct {
+			Host string
+		}
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilename: path.Join(dir, "main.yaml"),
+	}))
+	assert.Equal(t, 1, config.Port)
+	assert.Equal(t, "cert.pem", config.TLS.Cert)
+	assert.Equal(t, "ca.pem", config.TLS.Client.CA)
+	assert.Equal(t, "db", config.DB.Host)
+
+	// Other strings are not read as files.
+	err = LoadWithRawFile(config, []byte("tls: tls/tls.yaml\n"),
+		Conf{FileDecoder: DecoderYAML})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "value of type string given for composite config var tls")
+
+	// Section files are resolved after selecting the profiles, applying
+	// the alias table and normalizing the keys.
+	RegisterAliases(map[string]string{"database": "db"})
+	defer func() {
+		aliasTable = make(map[string]string)
+	}()
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "profiles.json"), []byte(`{
+		"default": {"TLS": "file://tls/tls.yaml"},
+		"dev": {"database": "file://db.json"}
+	}`), 0644))
+	config.TLS.Cert, config.TLS.Client.CA, config.DB.Host = "", "", ""
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilename:   path.Join(dir, "profiles.json"),
+		Profile:               "dev",
+		FileKeyNormalizer:     KeyNormalizerCaseInsensitive,
+		FileStrictUnknownKeys: true,
+	}))
+	assert.Equal(t, "cert.pem", config.TLS.Cert)
+	assert.Equal(t, "ca.pem", config.TLS.Client.CA)
+	assert.Equal(t, "db", config.DB.Host)
+
+	// The elements of lists of structs can refer to files as well.
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "servers.yaml"), []byte(
+		"servers:\n  - !include tls/server.yaml\n  - name: b\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "tls", "server.yaml"),
+		[]byte("name: a\ntls: !include client.yaml\n"), 0644))
+	servers := &struct {
+		Servers []struct {
+			Name string
+			TLS  struct {
+				CA string
+			}
+		}
+	}{}
+	require.NoError(t, Load(servers, Conf{
+		FileDefaultFilename: path.Join(dir, "servers.yaml"),
+	}))
+	require.Len(t, servers.Servers, 2)
+	assert.Equal(t, "a", servers.Servers[0].Name)
+	assert.Equal(t, "ca.pem", servers.Servers[0].TLS.CA)
+	assert.Equal(t, "b", servers.Servers[1].Name)
+}
+
+func TestDecoderYAML_Include(t *testing.T) {
+	m, err := DecoderYAML([]byte("a: !include a.yaml\nb:\n  c: !include \"c d.yaml\"\n" +
+		"e: '!include e.yaml'\n# f: !include f.yaml\nl:\n  - !include l.yaml\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"a": "file://a.yaml",
+		"b": map[string]interface{}{"c": "file://c d.yaml"},
+		"e": "!include e.yaml",
+		"l": []interface{}{"file://l.yaml"},
+	}, m)
+}
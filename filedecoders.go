@@ -5,11 +5,14 @@
 package gonfig
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/hashicorp/hcl"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -46,7 +49,7 @@ var DecoderTOML FileDecoderFn = func(c []byte) (map[string]interface{}, error) {
 // DecoderYAML is the YAML decoding function for config files.
 var DecoderYAML FileDecoderFn = func(c []byte) (map[string]interface{}, error) {
 	var m map[string]interface{}
-	if err := yaml.Unmarshal(c, &m); err != nil {
+	if err := yaml.Unmarshal(replaceYAMLIncludeTags(c), &m); err != nil {
 		return nil, fmt.Errorf("error parsing YAML config file: %s", err)
 	}
 	// Cast map[interface{}]interface{} to map[string]interface{}.
@@ -54,6 +57,94 @@ var DecoderYAML FileDecoderFn = func(c []byte) (map[string]interface{}, error) {
 	return m, nil
 }
 
+// yamlIncludeTag matches the values with the !include tag in YAML, like
+// "tls: !include tls.yaml" or "- !include 'a b.yaml'".
+var yamlIncludeTag = regexp.MustCompile(
+	`(?m)^(\s*(?:-\s+|[^#\n]*?:\s+))!include\s+(["']?)(.*?)\s*$`)
+
+// replaceYAMLIncludeTags replaces the !include tags in YAML with the file://
+// prefix that marks the values that refer to a section file, as the YAML
+// decoder drops unknown tags.
+func replaceYAMLIncludeTags(c []byte) []byte {
+	if !bytes.Contains(c, []byte("!include")) {
+		return c
+	}
+	return yamlIncludeTag.ReplaceAll(c, []byte("${1}${2}"+sectionFilePrefix+"${3}"))
+}
+
+// DecoderHCL is the HCL decoding function for config files.
+// Blocks are decoded as lists of maps, which are merged into a single map for
+// nested config vars and kept as a list for lists of structs.
+var DecoderHCL FileDecoderFn = func(c []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := hcl.Unmarshal(c, &m); err != nil {
+		return nil, fmt.Errorf("error parsing HCL config file: %s", err)
+	}
+	return m, nil
+}
+
+// DecoderINI is the INI decoding function for config files.
+// Sections are used for nested config variables; dots in section names, like
+// [server.tls], can be used for deeper nesting.  Both = and : can be used to
+// separate keys from values and lines starting with ; or # are comments.
+// All values are interpreted as strings, which means that slices should be
+// provided as comma separated values.
+var DecoderINI FileDecoderFn = func(c []byte) (map[string]interface{}, error) {
+	m, err := parseINI(c)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing INI config file: %s", err)
+	}
+
+	return m, nil
+}
+
+// parseINI parses the content of an INI file into a map.
+func parseINI(c []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	section := root
+	for i, line := range strings.Split(string(c), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("line %d: invalid section header", i+1)
+			}
+			section = root
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name = strings.TrimSpace(name)
+				sub, ok := section[name].(map[string]interface{})
+				if !ok {
+					sub = make(map[string]interface{})
+					section[name] = sub
+				}
+				section = sub
+			}
+			continue
+		}
+
+		sep := strings.IndexByte(line, '=')
+		if sep < 0 {
+			sep = strings.IndexByte(line, ':')
+		}
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+
+		key := strings.TrimSpace(line[:sep])
+		value := strings.TrimSpace(line[sep+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') &&
+			value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		section[key] = value
+	}
+
+	return root, nil
+}
+
 // NewMultiFileDecoder is a hybrid decoders that will try all the given decoders
 // and return the result of the first one that does not produce an error.
 func NewMultiFileDecoder(decoders []FileDecoderFn) FileDecoderFn {
@@ -0,0 +1,121 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultFileProfile is the key of the section of a config file with
+// profiles that applies to all profiles.
+const defaultFileProfile = "default"
+
+// fileProfilesEnabled returns whether config files contain a section per
+// profile.
+func fileProfilesEnabled(conf *Conf) bool {
+	return conf.Profile != "" || conf.ProfileVariable != ""
+}
+
+// selectedFileProfiles returns the profiles selected by the value of
+// Conf.ProfileVariable in the command line flags or the environment
+// variables, or by Conf.Profile otherwise.
+func selectedFileProfiles(s *setup) ([]string, error) {
+	profile := s.conf.Profile
+	if id := s.conf.ProfileVariable; id != "" {
+		var profileOpt *option
+		for _, opt := range s.opts {
+			if opt.id == id {
+				profileOpt = opt
+				break
+			}
+		}
+		if profileOpt == nil {
+			panic(fmt.Errorf("profile variable name provided (%s), "+
+				"but not defined in config struct", id))
+		}
+
+		// The flags take precedence over the environment variables.
+		val, err := lookupConfigFileFlag(s, profileOpt)
+		if err != nil {
+			return nil, err
+		}
+		if val == "" {
+			if val, err = lookupConfigFileEnv(s, profileOpt); err != nil {
+				return nil, err
+			}
+		}
+		if val != "" {
+			profile = val
+		}
+	}
+
+	var profiles []string
+	for _, p := range strings.Split(profile, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+// applyFileProfiles merges the default section of the decoded config file
+// with the sections of the selected profiles, in order.  Selected profiles
+// that are missing are skipped, as they can be defined in another config
+// file; checkFileProfiles checks that they are defined in any of them.
+func applyFileProfiles(s *setup, m map[string]interface{}) (map[string]interface{}, error) {
+	profiles, err := selectedFileProfiles(s)
+	if err != nil {
+		return nil, err
+	}
+
+	merge := s.conf.MergeFunc
+	if merge == nil {
+		merge = deepMerge
+	}
+
+	if s.foundProfiles == nil {
+		s.foundProfiles = make(map[string]bool)
+	}
+	s.profileFiles = append(s.profileFiles, s.configFilePath)
+
+	merged := make(map[string]interface{})
+	for _, profile := range append([]string{defaultFileProfile}, profiles...) {
+		val, ok := m[profile]
+		if !ok || val == nil {
+			continue
+		}
+		s.foundProfiles[profile] = true
+
+		section, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("value of type %T given for profile %s in "+
+				"config file at %s", val, profile, s.configFilePath)
+		}
+		merge(merged, section)
+	}
+
+	return merged, nil
+}
+
+// checkFileProfiles checks that the selected profiles are defined in at least
+// one of the decoded config files.
+func checkFileProfiles(s *setup) error {
+	if len(s.profileFiles) == 0 {
+		return nil
+	}
+
+	profiles, err := selectedFileProfiles(s)
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		if !s.foundProfiles[profile] {
+			return fmt.Errorf("profile %s not found in config file at %s",
+				profile, strings.Join(s.profileFiles, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// canonicalValues returns a map of the full IDs of all non-nested options to
+// their current value.  Secret options are excluded.
+func canonicalValues(s *setup) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, opt := range s.allOpts {
+		if opt.isParent || opt.secret {
+			continue
+		}
+		values[opt.fullID()] = opt.value.Interface()
+	}
+	return values
+}
+
+// CanonicalJSON returns a canonical JSON encoding of the effective
+// configuration in the config struct at c.  The encoding is a single JSON
+// object mapping the full IDs of all options to their values, with the keys
+// sorted, so that equal configurations always produce the same output.
+// Options marked as secret are not included.  An error is returned if there
+// is a problem with the configuration struct.
+func CanonicalJSON(c interface{}) ([]byte, error) {
+	s := &setup{
+		conf: &Conf{},
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		return nil, fmt.Errorf("error in config structure: %s", err)
+	}
+
+	// encoding/json sorts map keys, which makes the output stable.
+	return json.Marshal(canonicalValues(s))
+}
+
+// Fingerprint returns a stable hash of the effective configuration in the
+// config struct at c.  It is the hex-encoded SHA-256 hash of the output of
+// CanonicalJSON and can be used to detect configuration drift between
+// instances.
+//
+// An error is returned if there is a problem with the configuration struct or
+// if a value can not be encoded.
+func Fingerprint(c interface{}) (string, error) {
+	canonical, err := CanonicalJSON(c)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(canonical)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	type config struct {
+		Port   int
+		Host   string
+		Nested struct {
+			Names []string
+		}
+	}
+	c1 := &config{Port: 8080, Host: "localhost"}
+	c1.Nested.Names = []string{"one", "two"}
+	c2 := &config{Port: 8080, Host: "localhost"}
+	c2.Nested.Names = []string{"one", "two"}
+
+	canonical, err := CanonicalJSON(c1)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`{"host":"localhost","nested.names":["one","two"],"port":8080}`,
+		string(canonical))
+
+	fingerprint := func(c *config) string {
+		f, err := Fingerprint(c)
+		require.NoError(t, err)
+		return f
+	}
+	assert.Equal(t, fingerprint(c1), fingerprint(c2))
+	c2.Port = 8081
+	assert.NotEqual(t, fingerprint(c1), fingerprint(c2))
+
+	_, err = CanonicalJSON(&struct{ Map map[string]string }{})
+	assert.EqualError(t, err, "error in config structure: "+
+		"type of field Map (map[string]string) is not supported")
+	_, err = Fingerprint(&struct{ Map map[string]string }{})
+	assert.Error(t, err)
+}
@@ -2,27 +2,84 @@
 // Use of this source code is governed by an MIT-style
 // license that can be found in the LICENSE file.
 
+//go:build !gonfig_noflags
+// +build !gonfig_noflags
+
 package gonfig
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/pflag"
 )
 
+// FlagSet is the type of the flag sets used by gonfig for parsing command line
+// flags.  It is an alias for pflag.FlagSet.
+type FlagSet = pflag.FlagSet
+
+// ErrorHandling defines how errors from parsing the command line flags are
+// handled.  It is an alias for pflag.ErrorHandling.
+type ErrorHandling = pflag.ErrorHandling
+
+// flagState holds the command line flag state of the setup.
+type flagState struct {
+	flagSet *pflag.FlagSet
+}
+
 const (
 	defaultHelpDescription = "print this help menu"
 	defaultHelpMessage     = "Usage of __EXEC__:"
+
+	envFileDescription = "load environment variables from this file"
 )
 
 // addFlag adds a new flag to the flagset for the given option.
 // It will try to create a flag with the correct type and fallback to string
 // for unsupported types.
 func addFlag(flagSet *pflag.FlagSet, opt *option) {
+	if opt.isPointer {
+		// The flag has the type that is pointed to.
+		p := opt.pointee()
+		if opt.defaultSet {
+			p.defaultValue = opt.defaultValue.Elem()
+		}
+		opt = p
+	}
+
+	if len(opt.oneof) > 0 {
+		// Don't modify the original option.
+		described := *opt
+		described.desc = strings.TrimSpace(fmt.Sprintf("%s (one of: %s)",
+			opt.desc, strings.Join(opt.oneof, ", ")))
+		opt = &described
+	}
+
+	if opt.count {
+		flagSet.CountP(opt.fullID(), opt.short, opt.desc)
+		return
+	}
+
+	if opt.value.Type() == typeOfByteSize {
+		// Sizes are passed as strings, like "512MiB".
+		def := opt.defaul
+		if opt.defaultSet {
+			def = ByteSize(opt.defaultValue.Int()).String()
+		}
+		flagSet.StringP(opt.fullID(), opt.short, def, opt.desc)
+		return
+	}
+
+	if opt.value.Type() == typeOfDuration {
+		// Durations are passed as strings, like "1d12h".
+		flagSet.StringP(opt.fullID(), opt.short, opt.defaul, opt.desc)
+		return
+	}
+
 	switch opt.value.Type().Kind() {
 	case reflect.Bool:
 		var def bool
@@ -58,7 +115,12 @@ func addFlag(flagSet *pflag.FlagSet, opt *option) {
 			flagSet.StringP(opt.fullID(), opt.short, opt.defaul, opt.desc)
 			break
 		}
-		switch opt.value.Type().Elem().Kind() {
+		elemKind := opt.value.Type().Elem().Kind()
+		if opt.value.Type().Elem() == typeOfByteSize ||
+			opt.value.Type().Elem() == typeOfDuration {
+			elemKind = reflect.String
+		}
+		switch elemKind {
 		case reflect.Bool:
 			var def []bool
 			if opt.defaultSet {
@@ -117,10 +179,103 @@ func addFlag(flagSet *pflag.FlagSet, opt *option) {
 	}
 }
 
+// checkFlagConflicts checks that the flags for the options can be registered
+// on the external flag set, if any, without clashing with the shorthands of
+// the flags that are already registered on it.
+func checkFlagConflicts(s *setup) error {
+	flagSet := s.conf.FlagSet
+	if flagSet == nil {
+		return nil
+	}
+
+	for _, opt := range s.allOpts {
+		if opt.isParent || len(opt.short) != 1 || !opt.allowsSource(SourceFlag) {
+			continue
+		}
+		if flagSet.Lookup(opt.fullID()) != nil {
+			// The existing flag is reused.
+			continue
+		}
+
+		if f := flagSet.ShorthandLookup(opt.short); f != nil {
+			return fmt.Errorf("shorthand -%s for flag --%s is already used "+
+				"by flag --%s", opt.short, opt.fullID(), f.Name)
+		}
+	}
+
+	return nil
+}
+
+// negationPrefix is the prefix of the flags that negate boolean flags.
+const negationPrefix = "no-"
+
+// negationValue is the value of the flag that negates a boolean flag, like
+// --no-verbose for --verbose.  It sets the negated value on the boolean flag,
+// so that the last of both flags that is given wins.
+type negationValue struct {
+	flag pflag.Value
+}
+
+func (v *negationValue) String() string {
+	return "false"
+}
+
+func (v *negationValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	return v.flag.Set(strconv.FormatBool(!b))
+}
+
+// Type returns "bool", so that pflag treats the flag as a boolean flag.
+func (v *negationValue) Type() string {
+	return "bool"
+}
+
+// addNegationFlag adds the hidden --no-<flag> flag for the flag of a boolean
+// option, unless a flag with that name already exists.
+func addNegationFlag(flagSet *pflag.FlagSet, opt *option) {
+	t := opt.value.Type()
+	if opt.isPointer {
+		t = t.Elem()
+	}
+	f := flagSet.Lookup(opt.fullID())
+	if t.Kind() != reflect.Bool || f == nil {
+		return
+	}
+
+	name := negationPrefix + opt.fullID()
+	if flagSet.Lookup(name) != nil {
+		return
+	}
+	value := &negationValue{f.Value}
+	flagSet.VarPF(value, name, "", "").NoOptDefVal = "true"
+	flagSet.MarkHidden(name)
+}
+
+// negated returns whether the --no-<flag> flag of the boolean flag with the
+// given name has been given.
+func negated(flagSet *pflag.FlagSet, name string) bool {
+	f := flagSet.Lookup(negationPrefix + name)
+	if f == nil || !f.Changed {
+		return false
+	}
+	_, ok := f.Value.(*negationValue)
+	return ok
+}
+
 // createFlagSet builds the flagset for the options in the setup.
+// If an external flag set is configured, the flags are registered on that one
+// instead and the flags that are already registered on it are left alone.
 func createFlagSet(s *setup) *pflag.FlagSet {
-	flagSet := pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
-	flagSet.SortFlags = false
+	flagSet := s.conf.FlagSet
+	if flagSet == nil {
+		// Errors are handled by handleFlagError, so pflag never prints them.
+		flagSet = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+		flagSet.SortFlags = false
+		flagSet.Usage = func() {}
+	}
 
 	for _, opt := range s.allOpts {
 		if opt.isParent {
@@ -128,31 +283,94 @@ func createFlagSet(s *setup) *pflag.FlagSet {
 			continue
 		}
 
-		addFlag(flagSet, opt)
+		if opt.elemType != nil {
+			// Lists of structs can not be expressed as flags.
+			continue
+		}
+
+		if !opt.allowsSource(SourceFlag) {
+			// Not settable from the command line.
+			continue
+		}
+
+		if flagSet.Lookup(opt.fullID()) != nil {
+			// Already registered on the external flag set.
+			continue
+		}
+
+		flagOpt := *opt
+		if opt.secret {
+			// Don't leak secret default values in the help message.
+			flagOpt.defaultSet = false
+			flagOpt.defaul = ""
+		}
+		flagOpt.desc = expandDesc(s, &flagOpt)
+		if s.conf.HelpShowEnv && !s.conf.EnvDisable {
+			flagOpt.desc = strings.TrimSpace(fmt.Sprintf("%s (env: %s)",
+				flagOpt.desc, envKey(s.conf.EnvPrefix, opt.fullIDParts)))
+		}
+		addFlag(flagSet, &flagOpt)
+
+		if opt.deprecated != "" {
+			flagSet.MarkHidden(opt.fullID())
+		}
+
+		// Aliases are accepted, but not shown in the help message.
+		for _, alias := range opt.aliases {
+			name := aliasFullID(opt, alias)
+			if flagSet.Lookup(name) != nil {
+				continue
+			}
+
+			aliased := flagOpt
+			aliased.fullIDParts = aliasIDParts(opt, alias)
+			aliased.short = ""
+			addFlag(flagSet, &aliased)
+			flagSet.MarkHidden(name)
+		}
+	}
+
+	// Negations are added last, so that they never take the name of the flag
+	// of another option.
+	for _, opt := range s.allOpts {
+		if !opt.isParent && opt.elemType == nil && opt.allowsSource(SourceFlag) {
+			addNegationFlag(flagSet, opt)
+		}
+	}
+
+	if s.conf.EnvFileFlag != "" && !s.conf.EnvDisable &&
+		flagSet.Lookup(s.conf.EnvFileFlag) == nil {
+		flagSet.StringSlice(s.conf.EnvFileFlag, nil, envFileDescription)
 	}
 
-	if !s.conf.HelpDisable {
+	if !s.conf.HelpDisable && flagSet.Lookup("help") == nil {
 		desc := s.conf.HelpDescription
 		if desc == "" {
 			desc = defaultHelpDescription
 		}
 
-		flagSet.BoolP("help", "h", false, desc)
+		short := "h"
+		if flagSet.ShorthandLookup(short) != nil {
+			short = ""
+		}
+		help := helpValue("false")
+		flagSet.VarPF(&help, "help", short, desc).NoOptDefVal = "true"
 	}
 
 	return flagSet
 }
 
-// printHelpAndExit prints the help message and exits the program.
-func printHelpAndExit(s *setup) {
-	message := s.conf.HelpMessage
-	if message == "" {
-		exec := path.Base(os.Args[0])
-		message = strings.Replace(defaultHelpMessage, "__EXEC__", exec, 1)
+// printHelpAndExit prints the help message in the given format and exits the
+// program.
+func printHelpAndExit(s *setup, format string) {
+	write := writeHelp
+	if format == helpFormatJSON {
+		write = writeHelpJSON
 	}
 
-	fmt.Println(message)
-	fmt.Println(s.flagSet.FlagUsages())
+	if err := write(s, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error printing help message: %s\n", err)
+	}
 	os.Exit(2)
 }
 
@@ -165,39 +383,154 @@ func initFlags(s *setup) error {
 		return nil
 	}
 
+	if err := checkFlagConflicts(s); err != nil {
+		return err
+	}
 	s.flagSet = createFlagSet(s)
 
-	if err := s.flagSet.Parse(os.Args[1:]); err != nil {
-		return err
+	// An external flag set might already have been parsed.
+	if !s.flagSet.Parsed() {
+		args := s.conf.FlagArgs
+		if args == nil {
+			args = os.Args[1:]
+		}
+		if s.conf.FlagSingleDash {
+			args = singleDashArgs(s.flagSet, args)
+		}
+		if err := s.flagSet.Parse(args); err != nil {
+			return handleFlagError(s, &SourceError{Source: SourceFlag, Err: err})
+		}
+	}
+
+	if s.conf.ArgsOut != nil {
+		*s.conf.ArgsOut = s.flagSet.Args()
+	}
+	if s.conf.FlagSetOut != nil {
+		*s.conf.FlagSetOut = s.flagSet
 	}
 
 	// If help is provided, immediately print usage and stop.
-	if s.flagSet.Lookup("help").Changed {
-		printHelpAndExit(s)
+	if help := s.flagSet.Lookup("help"); !s.conf.HelpDisable && help != nil &&
+		help.Changed && help.Value.String() != "false" {
+		printHelpAndExit(s, help.Value.String())
 	}
 
 	return nil
 }
 
+// singleDashArgs rewrites the long flags given with a single dash in args,
+// like -config or -config=file, to use two dashes, for Conf.FlagSingleDash.
+// The arguments that are the values of the flags before them are left as is.
+func singleDashArgs(flagSet *pflag.FlagSet, args []string) []string {
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		out = append(out, arg)
+		if arg == "--" {
+			out = append(out, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+
+		// Find the flag that takes the next argument as its value, if any.
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			if !strings.Contains(arg, "=") {
+				flag = flagSet.Lookup(arg[2:])
+			}
+		} else if name := strings.SplitN(arg[1:], "=", 2)[0]; len(name) > 1 &&
+			flagSet.Lookup(name) != nil {
+			out[len(out)-1] = "-" + arg
+			if !strings.Contains(arg, "=") {
+				flag = flagSet.Lookup(name)
+			}
+		} else {
+			// A group of shorthands, of which the first one that takes a
+			// value takes the rest of the argument, if any.
+			for j := 1; j < len(arg) && arg[j] != '='; j++ {
+				f := flagSet.ShorthandLookup(arg[j : j+1])
+				if f != nil && f.NoOptDefVal == "" {
+					if j == len(arg)-1 {
+						flag = f
+					}
+					break
+				}
+			}
+		}
+
+		if flag != nil && flag.NoOptDefVal == "" && i+1 < len(args) {
+			i++
+			out = append(out, args[i])
+		}
+	}
+	return out
+}
+
+// handleFlagError handles an error from parsing the command line flags as
+// specified by Conf.FlagErrorHandling.  With pflag.ContinueOnError, the error
+// is returned.  With pflag.ExitOnError, the error and the help message are
+// printed to stderr and the program exits.  With pflag.PanicOnError, it
+// panics with the error.
+func handleFlagError(s *setup, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch s.conf.FlagErrorHandling {
+	case pflag.ExitOnError:
+		if errors.Is(err, pflag.ErrHelp) {
+			// Help was requested while the help flag is disabled.
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		if err := writeHelp(s, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "error printing help message: %s\n", err)
+		}
+		os.Exit(2)
+	case pflag.PanicOnError:
+		panic(err)
+	}
+	return err
+}
+
 // parseFlags parses the command line flags for all config options
 // and writes the values that have been found in place.
 func parseFlags(s *setup) error {
+	return handleFlagError(s, parseFlagValues(s))
+}
+
+// parseFlagValues writes the values of the command line flags that have been
+// set in place.
+func parseFlagValues(s *setup) error {
 	if err := initFlags(s); err != nil {
 		return err
 	}
 
 	for _, opt := range s.allOpts {
-		if opt.isParent {
+		if opt.isParent || !opt.allowsSource(SourceFlag) {
 			// Parents are skipped, we should only add the children.
 			continue
 		}
 
+		name := opt.fullID()
+		for _, alias := range opt.aliases {
+			if s.flagSet.Changed(name) {
+				break
+			}
+			if aliasName := aliasFullID(opt, alias); s.flagSet.Changed(aliasName) {
+				warn(s, "flag --%s is deprecated, use --%s instead", aliasName, name)
+				name = aliasName
+			}
+		}
+
 		// Prevent storing empty (unset) values.
-		if !s.flagSet.Changed(opt.fullID()) {
+		if !s.flagSet.Changed(name) && !negated(s.flagSet, name) {
 			continue
 		}
 
-		flag := s.flagSet.Lookup(opt.fullID())
+		flag := s.flagSet.Lookup(name)
 		stringValue := flag.Value.String()
 
 		if opt.isSlice {
@@ -205,8 +538,17 @@ func parseFlags(s *setup) error {
 			stringValue = stringValue[1 : len(stringValue)-1]
 		}
 
+		stringValue, err := resolveSecret(s, opt, stringValue)
+		if err != nil {
+			return err
+		}
+
+		before := opt.value.Interface()
 		if err := opt.setValueByString(stringValue); err != nil {
-			return fmt.Errorf("error parsing flag %s: %s", opt.fullID(), err)
+			return newParseError(opt, SourceFlag, stringValue, err)
+		}
+		if err := sourceSet(s, opt, SourceFlag, before); err != nil {
+			return err
 		}
 	}
 
@@ -224,3 +566,46 @@ func lookupConfigFileFlag(s *setup, configOpt *option) (string, error) {
 	}
 	return s.flagSet.Lookup(configOpt.fullID()).Value.String(), nil
 }
+
+// lookupEnvFilesFlag returns the env files passed through the env file flag.
+func lookupEnvFilesFlag(s *setup) ([]string, error) {
+	if s.conf.FlagDisable || s.conf.EnvFileFlag == "" {
+		return nil, nil
+	}
+
+	if err := initFlags(s); err != nil {
+		return nil, err
+	}
+
+	return s.flagSet.GetStringSlice(s.conf.EnvFileFlag)
+}
+
+// RegisterFlags registers the command line flags for the config struct at c on
+// the flag set given in conf.FlagSet and returns it.  If conf.FlagSet is nil,
+// the flags are registered on a new flag set, which is the same flag set Load
+// would construct.
+//
+// This allows integrating with other libraries that parse command line flags,
+// like cobra: register the flags on the external flag set before it is parsed
+// and then call Load with the same flag set in conf.FlagSet.
+//
+// This method panics if there is a problem with the configuration struct, in
+// the same way Load does.  It also writes the default values into c.
+func RegisterFlags(c interface{}, conf Conf) *FlagSet {
+	s := &setup{
+		conf: &conf,
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		panic(fmt.Errorf("error in config structure: %s", err))
+	}
+
+	// Errors in computed default values are reported by Load.
+	_ = checkDefaults(setDefaults(s))
+
+	if err := checkFlagConflicts(s); err != nil {
+		panic(fmt.Errorf("error registering flags: %s", err))
+	}
+
+	return createFlagSet(s)
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !gonfig_noflags
+// +build !gonfig_noflags
+
+package gonfig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests in this file use the internals of the command line flag support,
+// which is not built with the gonfig_noflags build tag.
+
+// requireFlags skips tests that pass command line flags when they are not
+// supported, see noflags_test.go.
+func requireFlags(t *testing.T) {}
+
+func TestLoad_FlagDisable(t *testing.T) {
+	type Config struct {
+		Port int `default:"80"`
+	}
+
+	// No flag set is constructed, so unknown flags are no error.
+	setOS([]string{"--port", "8080", "--unknown"}, nil)
+	s := newSetup(context.Background(), &Conf{FileDisable: true, FlagDisable: true}, &Config{})
+	require.NoError(t, load(s))
+	assert.Nil(t, s.flagSet)
+	assert.Equal(t, 80, s.opts[0].value.Interface())
+
+	// The flag set is only constructed to look for the config file.
+	setOS([]string{"--configfile", "/doesntexist.conf"}, nil)
+	s = newSetup(context.Background(), &Conf{
+		FlagDisable:        true,
+		ConfigFileVariable: "configfile",
+	}, &struct {
+		ConfigFile string
+	}{})
+	assert.Error(t, load(s))
+	assert.NotNil(t, s.flagSet)
+}
+
+func TestCreateFlagSet_SecretDefaultRedacted(t *testing.T) {
+	s := &setup{conf: &Conf{}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		Password string `secret:"true" default:"hunter2"`
+	}{}))
+	require.NoError(t, setDefaults(s))
+
+	usage := createFlagSet(s).FlagUsages()
+	assert.Contains(t, usage, "--password")
+	assert.NotContains(t, usage, "hunter2")
+}
+
+func TestCreateFlagSet_AliasesHidden(t *testing.T) {
+	s := &setup{conf: &Conf{}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		Name string `aliases:"old"`
+	}{}))
+
+	flagSet := createFlagSet(s)
+	require.NotNil(t, flagSet.Lookup("old"))
+	assert.NotContains(t, flagSet.FlagUsages(), "--old")
+}
+
+func TestCreateFlagSet_DescPlaceholders(t *testing.T) {
+	s := &setup{conf: &Conf{EnvPrefix: "APP_"}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		Port  int    `default:"80" desc:"port to listen on ({env}, default {default})"`
+		Token string `default:"hunter2" secret:"true" desc:"token [{default}]"`
+	}{}))
+	require.NoError(t, setDefaults(s))
+
+	usage := createFlagSet(s).FlagUsages()
+	assert.Contains(t, usage, "port to listen on (APP_PORT, default 80)")
+	assert.Contains(t, usage, "token []")
+	assert.NotContains(t, usage, "hunter2")
+}
+
+func TestCreateFlagSet_OneOfInHelp(t *testing.T) {
+	s := &setup{conf: &Conf{}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		Level string `oneof:"debug,info" desc:"the log level"`
+	}{}))
+
+	usage := createFlagSet(s).FlagUsages()
+	assert.Contains(t, usage, "the log level (one of: debug, info)")
+}
+
+func TestLoad_ExternalFlagSet(t *testing.T) {
+	setOS(nil, nil)
+	config := &struct {
+		V1 string `short:"v"`
+		V2 int    `default:"5"`
+	}{}
+
+	flagSet := pflag.NewFlagSet("external", pflag.ContinueOnError)
+	other := flagSet.Bool("other", false, "a flag from another library")
+	conf := Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		FlagSet:     flagSet,
+	}
+	assert.Equal(t, flagSet, RegisterFlags(config, conf))
+	require.NotNil(t, flagSet.Lookup("v1"))
+	require.NotNil(t, flagSet.Lookup("help"))
+
+	require.NoError(t, flagSet.Parse([]string{"-v", "value", "--other"}))
+	require.NoError(t, Load(config, conf))
+
+	assert.Equal(t, "value", config.V1)
+	assert.Equal(t, 5, config.V2)
+	assert.True(t, *other)
+}
+
+func TestLoad_FlagSetOut(t *testing.T) {
+	setOS(nil, nil)
+	config := &struct {
+		V1 string
+		V2 int `default:"5"`
+	}{}
+
+	var flagSet *FlagSet
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		FlagArgs:    []string{"--v1", "value"},
+		FlagSetOut:  &flagSet,
+	}))
+
+	require.NotNil(t, flagSet)
+	assert.True(t, flagSet.Parsed())
+	assert.True(t, flagSet.Changed("v1"))
+	assert.False(t, flagSet.Changed("v2"))
+
+	flagSet = nil
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		FlagDisable: true,
+		FlagSetOut:  &flagSet,
+	}))
+	assert.Nil(t, flagSet)
+}
+
+func TestLoad_Repeated(t *testing.T) {
+	setOS(nil, nil)
+	flagSet := pflag.NewFlagSet("external", pflag.ContinueOnError)
+	var conflicts []Conflict
+	conf := Conf{
+		FileDisable: true,
+		FlagSet:     flagSet,
+		FlagArgs:    []string{"-v", "value"},
+		Conflicts:   &conflicts,
+	}
+
+	type Config struct {
+		V1 string `short:"v" default:"default"`
+	}
+	for i := 0; i < 3; i++ {
+		config := &Config{}
+		require.NoError(t, Load(config, conf))
+		assert.Equal(t, "value", config.V1)
+		assert.Len(t, conflicts, 0)
+	}
+
+	// A different struct can reuse the same flags.
+	other := &struct {
+		V1 string
+		V2 int `default:"2"`
+	}{}
+	require.NoError(t, Load(other, conf))
+	assert.Equal(t, "value", other.V1)
+	assert.Equal(t, 2, other.V2)
+}
+
+func TestLoad_ShorthandConflict(t *testing.T) {
+	setOS(nil, nil)
+	flagSet := pflag.NewFlagSet("external", pflag.ContinueOnError)
+	flagSet.BoolP("verbose", "v", false, "")
+
+	err := Load(&struct {
+		Version string `short:"v"`
+	}{}, Conf{FileDisable: true, FlagSet: flagSet})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already used by flag --verbose")
+}
+
+func TestWriteHelp_Groups(t *testing.T) {
+	s := &setup{conf: &Conf{
+		EnvPrefix:   "APP_",
+		HelpMessage: "Usage:",
+		HelpShowEnv: true,
+	}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		Verbose bool   `desc:"verbose output"`
+		Host    string `group:"Networking" desc:"the host"`
+		TLS     struct {
+			Cert string `desc:"the certificate"`
+		} `group:"Networking"`
+		Dir string `group:"Storage"`
+	}{}))
+	require.NoError(t, setDefaults(s))
+	s.flagSet = createFlagSet(s)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeHelp(s, &buf))
+	help := buf.String()
+
+	assert.True(t, strings.HasPrefix(help, "Usage:\n"))
+	assert.Contains(t, help, "verbose output (env: APP_VERBOSE)")
+	networking := strings.Index(help, "Networking:\n")
+	storage := strings.Index(help, "Storage:\n")
+	require.True(t, networking > strings.Index(help, "--verbose"))
+	require.True(t, storage > networking)
+	assert.True(t, strings.Index(help, "--tls.cert") > networking)
+	assert.True(t, strings.Index(help, "--tls.cert") < storage)
+	assert.True(t, strings.Index(help, "--dir") > storage)
+}
+
+func TestWriteHelp_Template(t *testing.T) {
+	s := &setup{conf: &Conf{
+		HelpSortFlags: true,
+		HelpTemplate: "{{range .Groups}}[{{.Name}}]{{range .Flags}} {{.Name}}={{.Default}}" +
+			" ${{.Env}}{{end}}{{end}}",
+	}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		B int `group:"G" default:"2"`
+		A int `group:"G" default:"1"`
+	}{}))
+	require.NoError(t, setDefaults(s))
+	s.flagSet = createFlagSet(s)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeHelp(s, &buf))
+	assert.Equal(t, "[G] a=1 $A b=2 $B", buf.String())
+}
+
+func TestWriteHelpJSON(t *testing.T) {
+	s := &setup{conf: &Conf{EnvPrefix: "APP_"}}
+	require.NoError(t, inspectConfigStructure(s, &struct {
+		Port   int    `short:"p" default:"80" desc:"the port ({env}, default {default})" group:"Net"`
+		Token  string `secret:"true" default:"hunter2" noflag:"true" desc:"the token (default {default})"`
+		Nested struct {
+			Level string `oneof:"debug,info" required:"true"`
+		}
+	}{}))
+	require.NoError(t, setDefaults(s))
+	s.flagSet = createFlagSet(s)
+	require.NoError(t, s.flagSet.Parse([]string{"--help=json"}))
+	assert.Equal(t, "json", s.flagSet.Lookup("help").Value.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, writeHelpJSON(s, &buf))
+
+	var help struct {
+		Usage   string
+		Options []map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &help))
+	require.Len(t, help.Options, 3)
+	assert.Equal(t, map[string]interface{}{
+		"id": "port", "type": "int", "description": "the port (APP_PORT, default 80)", "default": "80",
+		"flag": "port", "shorthand": "p", "env": "APP_PORT", "group": "Net",
+	}, help.Options[0])
+	assert.Equal(t, map[string]interface{}{
+		"id": "token", "type": "string", "description": "the token (default )",
+		"env": "APP_TOKEN", "secret": true,
+	}, help.Options[1])
+	assert.Equal(t, "nested.level", help.Options[2]["id"])
+	assert.Equal(t, true, help.Options[2]["required"])
+}
+
+func TestCreateFlagSet_HelpIsBoolean(t *testing.T) {
+	s := &setup{conf: &Conf{}}
+	require.NoError(t, inspectConfigStructure(s, &struct{}{}))
+	flagSet := createFlagSet(s)
+
+	assert.Contains(t, flagSet.FlagUsages(), "-h, --help ")
+	assert.NotContains(t, flagSet.FlagUsages(), "[=")
+	assert.Error(t, flagSet.Parse([]string{"--help=xml"}))
+}
+
+func TestLoad_FlagErrorHandling(t *testing.T) {
+	config := &struct{ Port int }{}
+
+	setOS([]string{"--unknown"}, nil)
+	err := Load(config, Conf{FileDisable: true})
+	require.Error(t, err)
+	var sourceErr *SourceError
+	require.True(t, errors.As(err, &sourceErr))
+	assert.Equal(t, SourceFlag, sourceErr.Source)
+	assert.Contains(t, err.Error(), "unknown flag: --unknown")
+
+	setOS([]string{"-h"}, nil)
+	err = Load(config, Conf{FileDisable: true, HelpDisable: true})
+	assert.True(t, errors.Is(err, pflag.ErrHelp))
+
+	setOS([]string{"--port", "x"}, nil)
+	assert.Panics(t, func() {
+		Load(config, Conf{
+			FileDisable:       true,
+			FlagErrorHandling: pflag.PanicOnError,
+		})
+	})
+}
+
+func TestRegisterFlags_NewFlagSet(t *testing.T) {
+	flagSet := RegisterFlags(&struct {
+		V1 string
+	}{}, Conf{})
+	require.NotNil(t, flagSet)
+	assert.NotNil(t, flagSet.Lookup("v1"))
+}
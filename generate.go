@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// commonInitialisms are the words that are written in all capitals in Go
+// identifiers.
+var commonInitialisms = map[string]bool{
+	"api": true, "cpu": true, "dns": true, "http": true, "https": true,
+	"id": true, "ip": true, "json": true, "sql": true, "ssh": true, "tcp": true,
+	"tls": true, "ttl": true, "udp": true, "uri": true, "url": true,
+	"uuid": true, "yaml": true, "toml": true,
+}
+
+// fieldName converts a config key to an exported Go identifier, like
+// "read_timeout" to "ReadTimeout".
+func fieldName(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var name string
+	for _, word := range words {
+		if commonInitialisms[strings.ToLower(word)] {
+			name += strings.ToUpper(word)
+		} else {
+			runes := []rune(word)
+			name += string(unicode.ToUpper(runes[0])) + string(runes[1:])
+		}
+	}
+
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// structTag formats the tags as a Go struct tag literal.
+func structTag(tags [][2]string) string {
+	parts := make([]string, len(tags))
+	for i, tag := range tags {
+		parts[i] = tag[0] + ":" + strconv.Quote(tag[1])
+	}
+
+	tag := strings.Join(parts, " ")
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// generator holds the state of the generation of a config struct.
+type generator struct {
+	usesTime bool
+}
+
+// typeOf returns the Go type for the value decoded from a config file and its
+// representation in a default tag.  The last return value is false if the
+// type is not supported.
+func (g *generator) typeOf(val interface{}) (string, string, bool) {
+	switch v := val.(type) {
+	case bool:
+		return "bool", strconv.FormatBool(v), true
+	case int:
+		return "int", strconv.Itoa(v), true
+	case int64:
+		return "int", strconv.FormatInt(v, 10), true
+	case uint64:
+		return "uint", strconv.FormatUint(v, 10), true
+	case float64:
+		if v == float64(int64(v)) {
+			// JSON decodes all numbers as floats.
+			return "int", strconv.FormatInt(int64(v), 10), true
+		}
+		return "float64", strconv.FormatFloat(v, 'g', -1, 64), true
+	case string:
+		return "string", v, true
+	case nil:
+		return "string", "", true
+	case time.Time:
+		g.usesTime = true
+		return "time.Time", v.Format(time.RFC3339Nano), true
+
+	case []interface{}:
+		elemType := "string"
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			t, def, ok := g.typeOf(elem)
+			if !ok || strings.HasPrefix(t, "[]") {
+				return "", "", false
+			}
+			if i == 0 {
+				elemType = t
+			} else if t != elemType {
+				if t == "float64" && elemType == "int" {
+					elemType = t
+				} else if !(t == "int" && elemType == "float64") {
+					// Mixed types are kept as strings.
+					elemType = "string"
+				}
+			}
+			elems[i] = def
+		}
+		def, err := writeAsCSV(elems)
+		if err != nil {
+			return "", "", false
+		}
+		return "[]" + elemType, def, true
+
+	default:
+		return "", "", false
+	}
+}
+
+// writeStruct writes the fields of a struct type for the map to buf.
+func (g *generator) writeStruct(buf *bytes.Buffer, m map[string]interface{}) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf.WriteString("struct {\n")
+	names := make(map[string]int)
+	for _, key := range keys {
+		name := fieldName(key)
+		names[name]++
+		if n := names[name]; n > 1 {
+			name += strconv.Itoa(n)
+		}
+
+		tags := [][2]string{{fieldTagID, key}}
+		if sub, ok := m[key].(map[string]interface{}); ok {
+			fmt.Fprintf(buf, "%s ", name)
+			g.writeStruct(buf, sub)
+			fmt.Fprintf(buf, " %s\n", structTag(tags))
+			continue
+		}
+
+		t, def, ok := g.typeOf(m[key])
+		if !ok {
+			fmt.Fprintf(buf, "// %s: values of type %T are not supported\n",
+				key, m[key])
+			continue
+		}
+		if def != "" {
+			tags = append(tags, [2]string{fieldTagDefault, def})
+		}
+		fmt.Fprintf(buf, "%s %s %s\n", name, t, structTag(tags))
+	}
+	buf.WriteString("}")
+}
+
+// GenerateStruct generates the Go source of a file in package pkg that
+// declares a config struct type with the given name for the config file
+// content.  The types of the fields are inferred from the values in the file,
+// which are also used as default values.  Nested sections become nested
+// structs.  If decoder is nil, DecoderTryAll is used.
+//
+// The generated struct is meant as a starting point: values for which the
+// type can not be inferred, like lists of sections, are left out with a
+// comment.
+func GenerateStruct(content []byte, decoder FileDecoderFn, pkg, name string) ([]byte, error) {
+	if decoder == nil {
+		decoder = DecoderTryAll
+	}
+
+	m, err := decoder(content)
+	if err != nil {
+		return nil, err
+	}
+	mergeBlocks(&setup{conf: &Conf{}}, m, nil)
+
+	g := &generator{}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "type %s ", name)
+	g.writeStruct(&body, m)
+	body.WriteString("\n")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	if g.usesTime {
+		buf.WriteString("import \"time\"\n\n")
+	}
+	body.WriteTo(&buf)
+
+	return format.Source(buf.Bytes())
+}
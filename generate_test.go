@@ -0,0 +1,70 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldName(t *testing.T) {
+	assert.Equal(t, "ReadTimeout", fieldName("read_timeout"))
+	assert.Equal(t, "APIURL", fieldName("api-url"))
+	assert.Equal(t, "X2fa", fieldName("2fa"))
+}
+
+func TestGenerateStruct(t *testing.T) {
+	content := []byte(`{
+		"name": "app",
+		"port": 8080,
+		"ratio": 0.5,
+		"debug": true,
+		"hosts": ["a", "b,c"],
+		"read_timeout": 5,
+		"server": {"tls": {"cert_file": "/etc/cert"}},
+		"routes": [{"path": "/"}]
+	}`)
+
+	src, err := GenerateStruct(content, DecoderJSON, "config", "Config")
+	require.NoError(t, err)
+
+	expected := "package config\n\n" +
+		"type Config struct {\n" +
+		"\tDebug       bool     `id:\"debug\" default:\"true\"`\n" +
+		"\tHosts       []string `id:\"hosts\" default:\"a,\\\"b,c\\\"\"`\n" +
+		"\tName        string   `id:\"name\" default:\"app\"`\n" +
+		"\tPort        int      `id:\"port\" default:\"8080\"`\n" +
+		"\tRatio       float64  `id:\"ratio\" default:\"0.5\"`\n" +
+		"\tReadTimeout int      `id:\"read_timeout\" default:\"5\"`\n" +
+		"\t// routes: values of type []interface {} are not supported\n" +
+		"\tServer struct {\n" +
+		"\t\tTLS struct {\n" +
+		"\t\t\tCertFile string `id:\"cert_file\" default:\"/etc/cert\"`\n" +
+		"\t\t} `id:\"tls\"`\n" +
+		"\t} `id:\"server\"`\n" +
+		"}\n"
+	assert.Equal(t, expected, string(src))
+}
+
+func TestGenerateStruct_YAML(t *testing.T) {
+	content := []byte("name: app\nports: [80, 443]\n")
+
+	src, err := GenerateStruct(content, DecoderYAML, "main", "Config")
+	require.NoError(t, err)
+	assert.Contains(t, string(src), "Ports []int  `id:\"ports\" default:\"80,443\"`")
+}
+
+func TestGenerateStruct_NestedDefaults(t *testing.T) {
+	// The generated nested defaults are applied by Load.
+	config := &struct {
+		Server struct {
+			Port int `id:"port" default:"1"`
+		} `id:"server"`
+	}{}
+	require.NoError(t, LoadRawFile(config, []byte(`{}`), Conf{FileDecoder: DecoderJSON}))
+	assert.Equal(t, 1, config.Server.Port)
+}
@@ -5,11 +5,12 @@
 package gonfig
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"reflect"
-
-	"github.com/spf13/pflag"
+	"time"
 )
 
 // Conf is used to specify the intended behavior of gonfig.
@@ -21,35 +22,279 @@ type Conf struct {
 	// by its ID.  The default value for this variable is obviously ignored.
 	ConfigFileVariable string
 
+	// Profile selects the profiles of the config file to use, like "prod" or
+	// a comma separated list like "prod,eu".  When set, or when
+	// ProfileVariable is set, the top-level keys of config files are the names
+	// of the profiles.  The values for the config variables are those in the
+	// "default" section, overridden by the sections of the selected profiles
+	// in order.  A selected profile that is missing from all config files
+	// causes an error.
+	Profile string
+	// ProfileVariable is the config variable, like "profile", whose value in
+	// the command line flags or the environment variables selects the
+	// profiles instead of Profile, like with --profile prod.  Like
+	// ConfigFileVariable, it is read before the config file.
+	ProfileVariable string
+
 	// FileDisable disabled reading config variables from the config file.
 	FileDisable bool
 	// FileDefaultFilename is the default filename to look for for the config
 	// file.  If this is empty and no filename is explicitly provided, parsing
 	// a config file is skipped.
 	FileDefaultFilename string
+	// FileDefaultFilenames is a list of additional default config files.  All
+	// of them that exist are parsed in order, after FileDefaultFilename, with
+	// values in later files overriding the values of the same options in
+	// earlier files.  Like FileDefaultFilename, they are ignored when a config
+	// file is explicitly provided.
+	FileDefaultFilenames []string
+	// FileSearchPaths is a list of directories in which to look for the
+	// default config files.  For every relative default filename, the
+	// directories are tried in order and the first file found is used.
+	// Environment variables in the paths, like $HOME, are expanded.
+	// If empty, default filenames are resolved from the working directory.
+	FileSearchPaths []string
+	// FileUseUserConfigDir makes gonfig look for the default config files in
+	// the directory of the application in the user's config directory, as
+	// returned by os.UserConfigDir, before looking in FileSearchPaths or the
+	// working directory.  That is $XDG_CONFIG_HOME/<app> or ~/.config/<app>
+	// on Unix, ~/Library/Application Support/<app> on macOS and
+	// %AppData%\<app> on Windows.
+	FileUseUserConfigDir bool
+	// AppName is the name of the application, used for its directory in the
+	// user's config directory.  If empty, the name of the executable is used.
+	AppName string
+	// FileRequired makes loading fail when no config file is found.  The
+	// error contains all the paths that have been tried.
+	FileRequired bool
 	// FileDecoder specifies the decoder function to be used for decoding the
 	// config file.  The following decoders are provided, but the user can also
 	// specify a custom decoder function:
 	//  - DecoderYAML
 	//  - DecoderTOML
 	//  - DecoderJSON
+	//  - DecoderHCL
+	//  - DecoderINI
 	// If no decoder function is provided, gonfig tries to guess the function
-	// based on the file extension and otherwise tries them all in the above
-	// mentioned order.
+	// based on the file extension and otherwise tries the first three in the
+	// above mentioned order.
 	FileDecoder FileDecoderFn
+	// FileEmpty specifies what happens when the config file is empty or only
+	// contains whitespace: it is ignored (the default), ignored with a warning
+	// through WarnFunc, or an error wrapping ErrEmptyFile is returned.
+	FileEmpty EmptyFileAction
+	// FileStrictUnknownKeys makes parsing the config file fail when it
+	// contains keys that do not correspond to any config variable.  The error
+	// lists all unknown keys.
+	FileStrictUnknownKeys bool
+	// FileStrictTypes makes parsing the config file fail when the type of a
+	// value does not match the type of its config variable, instead of
+	// converting it, like for a number given for a string, a fraction for an
+	// integer or a string like "yes" for a boolean.  Strings are accepted for
+	// types that are parsed from text, like durations and sizes.  INI files
+	// only contain strings, so this is of no use for them.
+	FileStrictTypes bool
+	// UnknownKeyWarning is called for every key in the config file that does
+	// not correspond to any config variable, when FileStrictUnknownKeys is not
+	// set.  Keys of nested config variables are joined by dots.
+	UnknownKeyWarning func(key string)
+	// FileIncludeKey is the key in config files that lists other config
+	// files to include, like "include".  Its value is a path or a list of
+	// paths, relative to the including file.  The included files are merged
+	// in order using MergeFunc, with the values of the including file taking
+	// precedence.  Includes can be nested, but not form cycles.  If empty,
+	// includes are not supported.
+	FileIncludeKey string
+	// FileKeyNormalizer is applied to the keys in the config file and to the
+	// IDs of the config variables to match them more loosely.  The built-in
+	// KeyNormalizerCaseInsensitive and KeyNormalizerRelaxed can be used, the
+	// latter also ignores dashes and underscores.  By default, keys must match
+	// exactly.
+	FileKeyNormalizer func(key string) string
+	// MergeFunc merges the decoded map of a default config file (src) into
+	// the result of merging the ones before it (dst), when multiple default
+	// config files are found.  The default merges nested maps recursively and
+	// lets all other values in src replace those in dst.  Override it for
+	// other semantics, like removing keys that are set to null.
+	MergeFunc func(dst, src map[string]interface{})
 
 	// FlagDisable disabled reading config variables from the command line flags.
+	// When set, no flag set is constructed, unless ConfigFileVariable is set:
+	// the config file can still be passed through the command line.
+	// Building with the gonfig_noflags build tag removes the support for
+	// command line flags, and the dependency on pflag, altogether.
 	FlagDisable bool
+	// FlagSet is an external flag set on which gonfig registers its flags,
+	// for example the flag set of a cobra command.  Flags with the same name
+	// that are already registered on it are reused.  If the flag set has
+	// already been parsed, gonfig only reads the values from it.
+	// Use RegisterFlags to register the flags before the flag set is parsed.
+	FlagSet *FlagSet
+	// FlagErrorHandling defines how invalid command line flags, like unknown
+	// flags or values that can not be parsed, are handled.  The default,
+	// pflag.ContinueOnError, makes Load return the error without printing
+	// anything.  pflag.ExitOnError prints the error and the help message and
+	// exits, pflag.PanicOnError panics with the error.  The help flag always
+	// prints the help message and exits, unless HelpDisable is set.  Flag
+	// sets given in FlagSet parse the arguments with their own error handling.
+	FlagErrorHandling ErrorHandling
+	// FlagArgs are the arguments to parse the command line flags from.  If
+	// nil, os.Args[1:] is used.
+	FlagArgs []string
+	// FlagSingleDash makes long flags accept a single dash as well, like
+	// -config file or -config=file, like the flag package of the standard
+	// library.  Arguments with a single letter after the dash, or that do not
+	// match a long flag, are still parsed as shorthands, like -v or -vvv.
+	FlagSingleDash bool
+	// ArgsOut, if not nil, is used to store the positional arguments that are
+	// left after parsing the command line flags.
+	ArgsOut *[]string
+	// FlagSetOut, if not nil, is used to store the flag set that the command
+	// line flags were parsed with, to look up flags that are not config
+	// variables or to check which flags were changed.  It is left untouched
+	// when no flag set is constructed.
+	FlagSetOut **FlagSet
 
 	// EnvDisables disables reading config variables from the environment
-	// variables.
+	// variables.  The dotenv file and the env files are not loaded either and
+	// the env file flag is not registered.
 	EnvDisable bool
 	// EnvPrefix is the prefix to use for the the environment variables.
 	// gonfig does not add an underscore after the prefix.
 	EnvPrefix string
+	// EnvFileFlag is the name of a built-in command line flag, like "env-file",
+	// that can be used to pass files with extra environment variables.  The
+	// files use the Docker env file format and can be passed multiple times.
+	// Variables from the process environment take precedence over the ones in
+	// the files.  The built-in flag is disabled when this is empty.
+	EnvFileFlag string
+	// DotEnvDisable disables loading the dotenv file.
+	DotEnvDisable bool
+	// DotEnvFile is the dotenv file from which KEY=value pairs are loaded as
+	// additional environment variables, honoring EnvPrefix.  Variables from
+	// the process environment and from env files take precedence.
+	// It defaults to ".env", which is ignored when not present.
+	DotEnvFile string
+	// EnvExportSecrets makes AsEnviron include the values of secret config
+	// variables.
+	EnvExportSecrets bool
+
+	// WindowsService is the name of a Windows service whose parameters are
+	// used as a source of config variables.  Following the convention for
+	// services, the parameters are the values of the registry key
+	// HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\<name>\Parameters
+	// and the value names are the full IDs of the config variables, like
+	// "server.port".  String, expandable string, multi-string (for slices)
+	// and DWORD/QWORD values are supported.  Values from the registry take
+	// precedence over the config file but not over the other sources.  An
+	// empty name disables this source; on other platforms than Windows, Load
+	// returns an error when it is set.
+	WindowsService string
+
+	// CloudMetadata is the cloud provider whose instance metadata service is
+	// used as a source of config variables: CloudAWS (using IMDSv2), CloudGCP
+	// or CloudAzure.  Options with a metadata tag get the corresponding
+	// metadata value.  Values from the metadata service take precedence over
+	// the config file but not over the other sources.  An empty value
+	// disables this source.
+	CloudMetadata string
+	// CloudMetadataEndpoint overrides the base URL of the metadata service.
+	CloudMetadataEndpoint string
+	// CloudMetadataUserData enables reading the user data of the instance,
+	// if any, which is then decoded with FileDecoder like a config file.
+	// Only enable it when the user data of the instances is a config file
+	// and not, for example, a cloud-init script.
+	CloudMetadataUserData bool
+
+	// DNSZone is a DNS name, like "config.example.com", whose TXT records are
+	// used as a source of config variables.  Every TXT record of the form
+	// key=value sets the config variable with the key as full ID, like
+	// "server.port=8080".  Values from DNS take precedence over the config
+	// file but not over environment variables.  An empty zone disables this
+	// source.
+	DNSZone string
+	// DNSCacheTTL is the duration for which the TXT records are cached among
+	// all loads in the process.  It defaults to 5 minutes; a negative value
+	// disables caching.
+	DNSCacheTTL time.Duration
+	// DNSLookupTXT is the function used to look up the TXT records, with the
+	// context of the load.  It defaults to net.DefaultResolver.LookupTXT.
+	DNSLookupTXT func(ctx context.Context, name string) ([]string, error)
+
+	// FDSource is a file descriptor, like 3, from which key=value pairs are
+	// read, one per line, so that a supervisor process can pass configuration
+	// through an inherited pipe.  The keys are the full IDs of the config
+	// variables, like "server.port".  Values from the file descriptor take
+	// precedence over environment variables but not over command line flags.
+	// The file descriptor is read until EOF and then closed; its content is
+	// kept for later loads in the same process, until ForgetFDSource is
+	// called.  Zero, the default, disables this source.
+	FDSource int
+
+	// CustomSources are user-provided sources of config variables.  Every
+	// source returns a map that is structured like a decoded config file.
+	// They are loaded in order, after DNS and before the environment
+	// variables.
+	CustomSources []CustomSource
+
+	// DirSource is a directory in which every file holds the value of a config
+	// variable, like the directories in which Kubernetes mounts ConfigMaps and
+	// Secrets.  The file names are the keys, like in the config file, and
+	// nested keys are either subdirectories or joined by a double underscore,
+	// like "server__port".  A single trailing newline is stripped from the
+	// values.  Hidden files and files that do not correspond to a config
+	// variable are ignored, and so is the directory when it does not exist.
+	// Values from the directory take precedence over the custom sources but
+	// not over environment variables.  An empty value disables this source.
+	DirSource string
+
+	// SecretResolver is used to resolve the values of options marked with the
+	// secret tag.  The value provided by the config file, the environment
+	// variables or the command line flags is passed as a reference, like
+	// "file:/run/secrets/db_pass", and the result is used as the actual value.
+	// If nil, secret values are used as provided.
+	SecretResolver func(ref string) (string, error)
+
+	// Interpolate enables references to other config variables in the values
+	// of string config variables, and slices of strings, like
+	// "${data_dir}/app.log".  References are resolved after all sources have
+	// been parsed, so they use the final values, and can be nested, but not
+	// form cycles.  Secret config variables can only be referred to by other
+	// secret config variables.  Use $${ for a literal ${.
+	Interpolate bool
+
+	// Conflicts, if not nil, is used to record every config variable that has
+	// been provided by multiple sources with different values.  The overridden
+	// values are still silently replaced; this allows auditing which sources
+	// override which values.  The slice is reset at the start of every load.
+	Conflicts *[]Conflict
+
+	// Timings, if not nil, is filled with the time spent in every phase of
+	// the load: the inspection of the config struct, reading and decoding the
+	// config file, every other source and the validation.
+	Timings *LoadTimings
+	// StartupBudget is the time loading the configuration is expected to
+	// take at most.  When exceeded, a warning with the slowest phase is passed
+	// to WarnFunc.  Zero disables the check.
+	StartupBudget time.Duration
+
+	// DefaultFunc computes default values that can not be expressed as a
+	// static default tag, like the number of CPUs or the hostname.  It is
+	// called for every config variable and if it returns true, the returned
+	// value is used as the default value, taking precedence over Defaulter
+	// and the default tag.  Computed default values that fail to parse or
+	// validate make Load return a *ParseError or *ValidationError.
+	DefaultFunc func(opt OptionInfo) (string, bool)
+
+	// WarnFunc is called with a warning message when a deprecated config
+	// variable or an alias of a renamed config variable is used.  If nil,
+	// warnings are discarded.
+	WarnFunc func(msg string)
 
 	// HelpDisable disables printing the help message when the --help or -h flag
 	// is provided.
+	// With --help=json, a description of all config variables is printed in
+	// JSON instead, so that other tools can inspect the configuration.
 	HelpDisable bool
 	// HelpMessage is the message printed before the list of the flags when the
 	// user sets the --help flag.
@@ -58,20 +303,42 @@ type Conf struct {
 	// HelpDescription is the description to print for the help flag.
 	// By default, this is "show this help menu".
 	HelpDescription string
+	// HelpShowEnv adds the name of the environment variable of every config
+	// variable to its description in the help message.
+	HelpShowEnv bool
+	// HelpSortFlags sorts the flags alphabetically within every group in the
+	// help message, instead of listing them in the order of the struct.
+	HelpSortFlags bool
+	// HelpTemplate is a text/template used to render the help message.  It is
+	// executed with a HelpData value.  The default template prints the help
+	// message, the flags without a group and then every group under its name.
+	HelpTemplate string
 }
 
 // setup is the struct that keeps track of the state of the program throughout
 // the lifecycle of loading the configuration.
 type setup struct {
+	ctx  context.Context
 	conf *Conf
 
 	opts    []*option // Holds all top-level options in the config struct.
 	allOpts []*option // Holds all options and all sub-options recursively.
+	section string    // The ID of the section loaded by LoadSection, if any.
 
 	// Some cached variables to avoid having to generate them twice.
 	configFilePath   string
-	customConfigFile bool // Whether the config file is user-provided.
-	flagSet          *pflag.FlagSet
+	customConfigFile bool              // Whether the config file is user-provided.
+	configFileSource Source            // What selected the config file path.
+	extraEnv         map[string]string // Variables loaded from (dot)env files.
+	defaulter        Defaulter         // The config struct, if it computes defaults.
+	profileFiles     []string          // The config files with profiles decoded.
+	foundProfiles    map[string]bool   // The profiles found in any of them.
+	defaultsErr      error             // The error in the computed defaults.
+
+	start   time.Time   // When the load started.
+	timings LoadTimings // The time spent in the phases of the load.
+
+	flagState // The state of the command line flags, if supported.
 }
 
 // findCustomConfigFile finds out where to look for the config file.
@@ -102,6 +369,7 @@ func findCustomConfigFile(s *setup) (string, error) {
 		return "", err
 	}
 	if path != "" {
+		s.configFileSource = SourceFlag
 		return filepath.Abs(path)
 	}
 
@@ -110,6 +378,7 @@ func findCustomConfigFile(s *setup) (string, error) {
 		return "", err
 	}
 	if path != "" {
+		s.configFileSource = SourceEnv
 		return filepath.Abs(path)
 	}
 
@@ -119,31 +388,85 @@ func findCustomConfigFile(s *setup) (string, error) {
 // setDefaults writes the default values in the field values if a default value
 // has been provided.
 func setDefaults(s *setup) error {
-	for _, opt := range s.opts {
+	return setDefaultValues(s, s.allOpts)
+}
+
+// setDefaultValues writes the default values of the given options.
+func setDefaultValues(s *setup, allOpts []*option) error {
+	// Errors in computed default values are only known at runtime, so they are
+	// returned as *ParseError or *ValidationError after all other default
+	// values have been written.
+	var computedErr error
+	for _, opt := range allOpts {
+		computed := false
+		if !opt.isParent && opt.elemType == nil {
+			computed = computeDefault(s, opt)
+		}
 		if !opt.defaultSet {
 			continue
 		}
 
 		opt.defaultValue = reflect.New(opt.value.Type()).Elem()
+		target := opt.defaultValue
+		if opt.isPointer {
+			target.Set(reflect.New(opt.value.Type().Elem()))
+			target = target.Elem()
+		}
+		var err error
 		if opt.isSlice {
-			if err := parseSlice(opt.defaultValue, opt.defaul); err != nil {
-				return fmt.Errorf(
-					"error parsing default value for %s: %s", opt.fullID(), err)
-			}
+			err = parseSlice(target, opt.defaul)
 		} else {
-			if err := parseSimpleValue(opt.defaultValue, opt.defaul); err != nil {
+			err = parseSimpleValue(target, opt.defaul)
+		}
+		if err != nil {
+			if !computed {
 				return fmt.Errorf(
 					"error parsing default value for %s: %s", opt.fullID(), err)
 			}
+			if computedErr == nil {
+				computedErr = newParseError(opt, SourceDefault, opt.defaul, err)
+			}
+			opt.defaultSet = false
+			continue
 		}
 
 		if err := opt.setValue(opt.defaultValue); err != nil {
 			return fmt.Errorf("error setting default value for %s: %s",
 				opt.id, err)
 		}
+
+		normalize(opt)
+
+		if err := validate(opt); err != nil {
+			if !computed {
+				return fmt.Errorf("error in default value: %s", err)
+			}
+			if computedErr == nil {
+				err.Source = SourceDefault
+				computedErr = err
+			}
+		}
 	}
 
-	return nil
+	return computedErr
+}
+
+// finalize performs the steps that need to happen after all sources have been
+// parsed.
+func finalize(s *setup) error {
+	if err := resolveFallbacks(s); err != nil {
+		return err
+	}
+
+	if err := interpolate(s); err != nil {
+		return err
+	}
+
+	if err := checkRequired(s.allOpts); err != nil {
+		return err
+	}
+
+	return checkAssertions(s)
 }
 
 // Load loads the configuration of your program in the struct at c.
@@ -153,22 +476,195 @@ func setDefaults(s *setup) error {
 // is used (which should not happen at runtime), but will always try to produce
 // an error instead if the user provided incorrect values.
 //
+// Load can be called multiple times, also for different config structs, as
+// every call is independent: flags are registered on a new flag set, or reused
+// when they already exist on Conf.FlagSet.  Load only writes the config
+// variables that have a default value or that are provided by a source, so
+// other fields keep their value from a previous call; use a new struct to
+// load from scratch.  When an error is returned, the struct might have been
+// written partially.
+//
 // The recognised tags on the exported struct variables are:
 //  - id: the keyword identifier (defaults to lowercase of variable name)
 //  - default: the default value of the variable
 //  - short: the shorthand used for command line flags (like -h)
-//  - desc: the description of the config var, used in --help
+//  - desc: the description of the config var, used in --help; the
+//    placeholders {default} and {env} are replaced by the default value and the
+//    name of the environment variable
+//  - assert: an expression that must hold for the loaded configuration, like
+//    "port > 1024 || user == 'root'"
+//  - secret: set to "true" for sensitive values, which are resolved using
+//    Conf.SecretResolver and are never shown in help or dump output
+//  - oneof: a comma separated list of the allowed values, like
+//    "debug,info,warn,error"
+//  - metadata: the cloud metadata value to use, one of "instance-id",
+//    "region", "zone" or "hostname"
+//  - fallback: the ID of another config var of the same type whose value is
+//    used when this one is not provided by any source; its own default value,
+//    if any, is only overridden when the other config var has been provided
+//  - required: set to "true" to return an error wrapping ErrMissingRequired
+//    when the config var is not provided by any source and has no default
+//  - aliases: a comma separated list of old IDs that are still accepted from
+//    the config file, the environment and the flags, with a warning
+//  - deprecated: a message, like "use --new-name", that is passed to
+//    Conf.WarnFunc when the config var is used; the flag is hidden from --help
+//  - normalize: a comma separated list of normalizers applied to the value
+//    from any source: "trim", "lower" and "upper" for strings and slices of
+//    strings, and "dedupe" to remove duplicates from slices
+//  - sources: a comma separated list of the sources that may set the config
+//    var, like "env,flag"; other sources providing a value cause an error
+//  - noflag: set to "true" to not create a command line flag for the config var
+//  - count: set to "true" for integers whose flag counts how often it is given,
+//    like -v -v -v or -vvv for a verbosity level of 3
+//  - nofile: set to "true" to refuse a value for the config var from the config
+//    file
+//  - sensitive: set to "true" for credentials that must never be stored at
+//    rest; the config var is secret, can not have a default value and a value
+//    for it in the config file causes an error
+//  - group: the section under which the flag is listed in --help; nested
+//    config vars inherit the group of their parent
+//  - min, max: the range of allowed values for numbers
+//  - pattern: a regular expression that string values must match
+// For slices, the oneof, min, max and pattern tags apply to every element and
+// the required tag also rejects empty elements.
 func Load(c interface{}, conf Conf) error {
+	return LoadContext(context.Background(), c, conf)
+}
+
+// newSetup creates the setup for loading the config structs cs and writes the
+// default values.
+func newSetup(ctx context.Context, conf *Conf, cs ...interface{}) *setup {
+	return newSectionSetup(ctx, conf, "", cs...)
+}
+
+// newSectionSetup is like newSetup, but for the config structs of the section
+// with the given ID.
+func newSectionSetup(ctx context.Context, conf *Conf, section string, cs ...interface{}) *setup {
 	s := &setup{
-		conf: &conf,
+		ctx:     ctx,
+		conf:    conf,
+		section: section,
+		start:   time.Now(),
 	}
+	defer timePhase(s, PhaseInspect, s.start)
 
-	if err := inspectConfigStructure(s, c); err != nil {
+	if err := inspectConfigStructure(s, cs...); err != nil {
 		panic(fmt.Errorf("error in config structure: %s", err))
 	}
 
-	if err := setDefaults(s); err != nil {
-		panic(fmt.Errorf("error in default values: %s", err))
+	s.defaultsErr = checkDefaults(setDefaults(s))
+
+	if s.conf.Conflicts != nil {
+		*s.conf.Conflicts = nil
+	}
+
+	return s
+}
+
+// parseSources parses all sources after the config file in order of
+// increasing priority and finalizes the loaded values.  It stops as soon as
+// the context is done.
+func parseSources(s *setup) error {
+	sources := []struct {
+		source  Source
+		enabled bool
+		parse   func(*setup) error
+	}{
+		{SourceRegistry, s.conf.WindowsService != "", parseRegistry},
+		{SourceMetadata, s.conf.CloudMetadata != "", parseMetadata},
+		{SourceDNS, s.conf.DNSZone != "", parseDNS},
+		{SourceCustom, len(s.conf.CustomSources) > 0, parseCustomSources},
+		{SourceDir, s.conf.DirSource != "", parseDir},
+		{SourceEnv, !s.conf.EnvDisable, parseEnv},
+		{SourceFD, s.conf.FDSource != 0, parseFD},
+		{SourceFlag, !s.conf.FlagDisable, parseFlags},
+	}
+
+	for _, source := range sources {
+		if !source.enabled {
+			continue
+		}
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := source.parse(s)
+		timePhase(s, string(source.source), start)
+		if err != nil {
+			return sourceError(s, source.source, err)
+		}
+	}
+
+	defer timePhase(s, PhaseValidate, time.Now())
+	if err := finalize(s); err != nil {
+		return err
+	}
+
+	storeAtomics(s.allOpts)
+	return nil
+}
+
+// sourceError wraps an error of a remote source in a SourceError, unless it
+// is about a single config variable or the load has been canceled.
+func sourceError(s *setup, source Source, err error) error {
+	switch source {
+	case SourceRegistry, SourceMetadata, SourceDNS, SourceCustom:
+	default:
+		return err
+	}
+
+	var parseErr *ParseError
+	var validationErr *ValidationError
+	var sourceErr *SourceError
+	if s.ctx.Err() != nil || errors.Is(err, ErrMissingRequired) ||
+		errors.As(err, &parseErr) || errors.As(err, &validationErr) ||
+		errors.As(err, &sourceErr) {
+		return err
+	}
+	return &SourceError{Source: source, Err: err}
+}
+
+// LoadContext is like Load, but stops loading when the context is done.
+// The context is passed to the sources that perform I/O, like the config file,
+// the cloud metadata service, DNS and the custom sources in Conf.CustomSources.
+func LoadContext(ctx context.Context, c interface{}, conf Conf) error {
+	return load(newSetup(ctx, &conf, c))
+}
+
+// LoadMulti is like Load, but loads the configuration of multiple config
+// structs at once, like those of independent modules of an application.  The
+// config variables of all structs share a single namespace in the config file,
+// the environment variables and the command line flags, so their IDs and
+// shorthands must not collide.
+//
+// This method panics on colliding IDs, as it does for other problems with the
+// config structs.
+func LoadMulti(conf Conf, targets ...interface{}) error {
+	return load(newSetup(context.Background(), &conf, targets...))
+}
+
+// LoadSection is like Load, but loads the config struct at c as the section
+// with the given ID, like "server" or "services.api", of a larger
+// configuration.  This allows components to load their own section of a
+// shared config file without knowing about the rest of the configuration.
+// The config variables of the section are prefixed with the section ID in all
+// sources, so a field Port of the section "server" is loaded from the key
+// "port" of the "server" object in the config file, from the environment
+// variable SERVER_PORT and from the flag --server.port.  Keys in the config
+// file outside of the section are not reported as unknown.
+//
+// This method panics if there is a problem with the configuration struct, in
+// the same way Load does.
+func LoadSection(c interface{}, sectionID string, conf Conf) error {
+	return load(newSectionSetup(context.Background(), &conf, sectionID, c))
+}
+
+// load loads the configuration from all sources for the setup.
+func load(s *setup) error {
+	defer finishTimings(s)
+
+	if s.defaultsErr != nil {
+		return s.defaultsErr
 	}
 
 	// Parse in order of opposite priority: file, env, flags
@@ -181,38 +677,20 @@ func Load(c interface{}, conf Conf) error {
 
 		if filename != "" {
 			s.customConfigFile = true
-		} else {
-			s.customConfigFile = false
-			if s.conf.FileDefaultFilename != "" {
-				filename, err = filepath.Abs(s.conf.FileDefaultFilename)
-				if err != nil {
-					return fmt.Errorf("failed to convert default config file "+
-						"location to an absolute path: %s", err)
-				}
-			}
-		}
-
-		if filename != "" {
 			s.configFilePath = filename
 			if err := parseFile(s); err != nil {
 				return err
 			}
+		} else {
+			s.customConfigFile = false
+			s.configFileSource = SourceDefault
+			if err := parseDefaultFiles(s); err != nil {
+				return err
+			}
 		}
 	}
 
-	if !s.conf.EnvDisable {
-		if err := parseEnv(s); err != nil {
-			return err
-		}
-	}
-
-	if !s.conf.FlagDisable {
-		if err := parseFlags(s); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return parseSources(s)
 }
 
 // LoadRawFile loads the configuration of your program in the struct at c from
@@ -228,9 +706,53 @@ func Load(c interface{}, conf Conf) error {
 //  - id: the keyword identifier (defaults to lowercase of variable name)
 //  - default: the default value of the variable
 //  - short: the shorthand used for command line flags (like -h)
-//  - desc: the description of the config var, used in --help
+//  - desc: the description of the config var, used in --help; the
+//    placeholders {default} and {env} are replaced by the default value and the
+//    name of the environment variable
+//  - assert: an expression that must hold for the loaded configuration, like
+//    "port > 1024 || user == 'root'"
+//  - secret: set to "true" for sensitive values, which are resolved using
+//    Conf.SecretResolver and are never shown in help or dump output
+//  - oneof: a comma separated list of the allowed values, like
+//    "debug,info,warn,error"
+//  - metadata: the cloud metadata value to use, one of "instance-id",
+//    "region", "zone" or "hostname"
+//  - fallback: the ID of another config var of the same type whose value is
+//    used when this one is not provided by any source; its own default value,
+//    if any, is only overridden when the other config var has been provided
+//  - required: set to "true" to return an error wrapping ErrMissingRequired
+//    when the config var is not provided by any source and has no default
+//  - aliases: a comma separated list of old IDs that are still accepted from
+//    the config file, the environment and the flags, with a warning
+//  - deprecated: a message, like "use --new-name", that is passed to
+//    Conf.WarnFunc when the config var is used; the flag is hidden from --help
+//  - normalize: a comma separated list of normalizers applied to the value
+//    from any source: "trim", "lower" and "upper" for strings and slices of
+//    strings, and "dedupe" to remove duplicates from slices
+//  - sources: a comma separated list of the sources that may set the config
+//    var, like "env,flag"; other sources providing a value cause an error
+//  - noflag: set to "true" to not create a command line flag for the config var
+//  - count: set to "true" for integers whose flag counts how often it is given,
+//    like -v -v -v or -vvv for a verbosity level of 3
+//  - nofile: set to "true" to refuse a value for the config var from the config
+//    file
+//  - sensitive: set to "true" for credentials that must never be stored at
+//    rest; the config var is secret, can not have a default value and a value
+//    for it in the config file causes an error
+//  - group: the section under which the flag is listed in --help; nested
+//    config vars inherit the group of their parent
+//  - min, max: the range of allowed values for numbers
+//  - pattern: a regular expression that string values must match
+// For slices, the oneof, min, max and pattern tags apply to every element and
+// the required tag also rejects empty elements.
 func LoadRawFile(c interface{}, fileContent []byte, conf Conf) error {
+	conf.WindowsService = ""
+	conf.CustomSources = nil
+	conf.DirSource = ""
+	conf.CloudMetadata = ""
+	conf.DNSZone = ""
 	conf.EnvDisable = true
+	conf.FDSource = 0
 	conf.FlagDisable = true
 	return LoadWithRawFile(c, fileContent, conf)
 }
@@ -249,39 +771,60 @@ func LoadRawFile(c interface{}, fileContent []byte, conf Conf) error {
 //  - id: the keyword identifier (defaults to lowercase of variable name)
 //  - default: the default value of the variable
 //  - short: the shorthand used for command line flags (like -h)
-//  - desc: the description of the config var, used in --help
+//  - desc: the description of the config var, used in --help; the
+//    placeholders {default} and {env} are replaced by the default value and the
+//    name of the environment variable
+//  - assert: an expression that must hold for the loaded configuration, like
+//    "port > 1024 || user == 'root'"
+//  - secret: set to "true" for sensitive values, which are resolved using
+//    Conf.SecretResolver and are never shown in help or dump output
+//  - oneof: a comma separated list of the allowed values, like
+//    "debug,info,warn,error"
+//  - metadata: the cloud metadata value to use, one of "instance-id",
+//    "region", "zone" or "hostname"
+//  - fallback: the ID of another config var of the same type whose value is
+//    used when this one is not provided by any source; its own default value,
+//    if any, is only overridden when the other config var has been provided
+//  - required: set to "true" to return an error wrapping ErrMissingRequired
+//    when the config var is not provided by any source and has no default
+//  - aliases: a comma separated list of old IDs that are still accepted from
+//    the config file, the environment and the flags, with a warning
+//  - deprecated: a message, like "use --new-name", that is passed to
+//    Conf.WarnFunc when the config var is used; the flag is hidden from --help
+//  - normalize: a comma separated list of normalizers applied to the value
+//    from any source: "trim", "lower" and "upper" for strings and slices of
+//    strings, and "dedupe" to remove duplicates from slices
+//  - sources: a comma separated list of the sources that may set the config
+//    var, like "env,flag"; other sources providing a value cause an error
+//  - noflag: set to "true" to not create a command line flag for the config var
+//  - count: set to "true" for integers whose flag counts how often it is given,
+//    like -v -v -v or -vvv for a verbosity level of 3
+//  - nofile: set to "true" to refuse a value for the config var from the config
+//    file
+//  - sensitive: set to "true" for credentials that must never be stored at
+//    rest; the config var is secret, can not have a default value and a value
+//    for it in the config file causes an error
+//  - group: the section under which the flag is listed in --help; nested
+//    config vars inherit the group of their parent
+//  - min, max: the range of allowed values for numbers
+//  - pattern: a regular expression that string values must match
+// For slices, the oneof, min, max and pattern tags apply to every element and
+// the required tag also rejects empty elements.
 func LoadWithRawFile(c interface{}, fileContent []byte, conf Conf) error {
-	s := &setup{
-		conf: &conf,
-	}
-
-	if err := inspectConfigStructure(s, c); err != nil {
-		panic(fmt.Errorf("error in config structure: %s", err))
-	}
-
-	if err := setDefaults(s); err != nil {
-		panic(fmt.Errorf("error in default values: %s", err))
-	}
+	s := newSetup(context.Background(), &conf, c)
+	defer finishTimings(s)
 
 	if s.conf.FileDisable {
 		panic("can't use LoadWithRawFile with DisableFile set to true")
 	}
 
-	if err := parseFileContent(s, fileContent); err != nil {
-		return err
-	}
-
-	if !s.conf.EnvDisable {
-		if err := parseEnv(s); err != nil {
-			return err
-		}
+	if s.defaultsErr != nil {
+		return s.defaultsErr
 	}
 
-	if !s.conf.FlagDisable {
-		if err := parseFlags(s); err != nil {
-			return err
-		}
+	if err := parseFileContent(s, fileContent); err != nil {
+		return err
 	}
 
-	return nil
+	return parseSources(s)
 }
@@ -5,11 +5,14 @@
 package gonfig
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -55,6 +58,17 @@ func (m *ErrorMarshaler) UnmarshalText(t []byte) error {
 	return errors.New("error")
 }
 
+type FailingMarshaler string
+
+func (m FailingMarshaler) MarshalText() ([]byte, error) {
+	return nil, errors.New("error")
+}
+
+func (m *FailingMarshaler) UnmarshalText(t []byte) error {
+	*m = FailingMarshaler(t)
+	return nil
+}
+
 type HexEncoded []byte
 
 func (h HexEncoded) String() string {
@@ -366,6 +380,99 @@ func TestGonfig(t *testing.T) {
 				assert.EqualValues(t, "010203", c.HexData.String())
 			},
 		},
+		{
+			desc: "ini",
+			args: []string{"--uint8var", "42"},
+			env:  map[string]string{"UINT16VAR": "42"},
+			fileContent: "; comment\n" +
+				"stringvar = stringvalue\n" +
+				"uintvar = 43\n" +
+				"intvar = -43\n" +
+				"boolvar1 = true\n" +
+				"float = -0.5\n" +
+				"float64var: -0.25\n" +
+				"int-32-var = 42\n" +
+				"bytes1 = AQID\n" +
+				"strings1 = one,two,three\n" +
+				"ints = \"1,2,3\"\n" +
+				"upper1 = TEST\n" +
+				"hex = 010203\n" +
+				"[nestedid]\n" +
+				"stringvar = otherstringvalue\n" +
+				"int = 42\n",
+			conf: Conf{
+				FileDecoder: DecoderINI,
+			},
+			config: &TestStruct{},
+			validate: func(t *testing.T, config interface{}) {
+				c, success := config.(*TestStruct)
+				require.True(t, success)
+
+				assert.EqualValues(t, "stringvalue", c.StringVar)
+				assert.EqualValues(t, 43, c.UintVar)
+				assert.EqualValues(t, -43, c.IntVar)
+				assert.EqualValues(t, true, c.BoolVar1)
+				assert.EqualValues(t, -0.5, c.Float32Var)
+				assert.EqualValues(t, -0.25, c.Float64Var)
+				assert.EqualValues(t, 42, c.Uint8Var)
+				assert.EqualValues(t, 42, c.Uint16Var)
+				assert.EqualValues(t, 42, c.Int32Var)
+				assert.EqualValues(t, []byte{1, 2, 3}, c.ByteSliceVar1)
+				assert.EqualValues(t, "otherstringvalue", c.Nested.StringVar)
+				assert.EqualValues(t, 42, c.Nested.IntVar)
+				assert.EqualValues(t, []string{"one", "two", "three"}, c.Strings1)
+				assert.EqualValues(t, []int{1, 2, 3}, c.Ints1)
+				assert.EqualValues(t, "test", c.Marshaled.String())
+				assert.EqualValues(t, "010203", c.HexData.String())
+			},
+		},
+		{
+			desc: "hcl",
+			args: []string{"--uint8var", "42"},
+			env:  map[string]string{"UINT16VAR": "42"},
+			fileContent: "# comment\n" +
+				"stringvar = \"stringvalue\"\n" +
+				"uintvar = 43\n" +
+				"intvar = -43\n" +
+				"boolvar1 = true\n" +
+				"float = -0.5\n" +
+				"float64var = -0.25\n" +
+				"int-32-var = 42\n" +
+				"bytes1 = \"AQID\"\n" +
+				"strings1 = [\"one\", \"two\", \"three\"]\n" +
+				"ints = [1, 2, 3]\n" +
+				"upper1 = \"TEST\"\n" +
+				"hex = \"010203\"\n" +
+				"nestedid {\n" +
+				"  stringvar = \"otherstringvalue\"\n" +
+				"  int = 42\n" +
+				"}\n",
+			conf: Conf{
+				FileDecoder: DecoderHCL,
+			},
+			config: &TestStruct{},
+			validate: func(t *testing.T, config interface{}) {
+				c, success := config.(*TestStruct)
+				require.True(t, success)
+
+				assert.EqualValues(t, "stringvalue", c.StringVar)
+				assert.EqualValues(t, 43, c.UintVar)
+				assert.EqualValues(t, -43, c.IntVar)
+				assert.EqualValues(t, true, c.BoolVar1)
+				assert.EqualValues(t, -0.5, c.Float32Var)
+				assert.EqualValues(t, -0.25, c.Float64Var)
+				assert.EqualValues(t, 42, c.Uint8Var)
+				assert.EqualValues(t, 42, c.Uint16Var)
+				assert.EqualValues(t, 42, c.Int32Var)
+				assert.EqualValues(t, []byte{1, 2, 3}, c.ByteSliceVar1)
+				assert.EqualValues(t, "otherstringvalue", c.Nested.StringVar)
+				assert.EqualValues(t, 42, c.Nested.IntVar)
+				assert.EqualValues(t, []string{"one", "two", "three"}, c.Strings1)
+				assert.EqualValues(t, []int{1, 2, 3}, c.Ints1)
+				assert.EqualValues(t, "test", c.Marshaled.String())
+				assert.EqualValues(t, "010203", c.HexData.String())
+			},
+		},
 		{
 			desc: "interface type not supported",
 			config: &struct {
@@ -658,10 +765,137 @@ func TestGonfig(t *testing.T) {
 			},
 			shouldError: true,
 		},
+		{
+			desc: "assertion holds",
+			config: &struct {
+				Port int    `assert:"port > 1024 || user == 'root'"`
+				User string `default:"root"`
+			}{},
+			conf: Conf{EnvDisable: true, FileDisable: true},
+			args: []string{"--port", "80"},
+		},
+		{
+			desc: "assertion fails",
+			config: &struct {
+				Port int    `assert:"port > 1024 || user == 'root'"`
+				User string `default:"nobody"`
+			}{},
+			conf:        Conf{EnvDisable: true, FileDisable: true},
+			args:        []string{"--port", "80"},
+			shouldError: true,
+		},
+		{
+			desc: "assertion on nested sibling",
+			config: &struct {
+				Server struct {
+					Min int
+					Max int `assert:"max >= min && !(max == 100)"`
+				}
+			}{},
+			conf:        Conf{EnvDisable: true, FileDisable: true},
+			args:        []string{"--server.min", "5", "--server.max", "3"},
+			shouldError: true,
+		},
+		{
+			desc: "assertion with unknown variable",
+			config: &struct {
+				V int `assert:"w > 5"`
+			}{},
+			shouldPanic: true,
+		},
+		{
+			desc: "oneof valid value",
+			config: &struct {
+				Level string `oneof:"debug,info" default:"info"`
+			}{},
+			conf: Conf{EnvDisable: true, FileDisable: true},
+			args: []string{"--level", "debug"},
+		},
+		{
+			desc: "oneof invalid value",
+			config: &struct {
+				Level string `oneof:"debug,info" default:"info"`
+			}{},
+			conf: Conf{FlagDisable: true, FileDisable: true},
+			env: map[string]string{
+				"LEVEL": "warn",
+			},
+			shouldError: true,
+		},
+		{
+			desc: "oneof invalid slice element",
+			config: &struct {
+				Levels []string `oneof:"debug,info"`
+			}{},
+			conf:        Conf{EnvDisable: true, FileDisable: true},
+			args:        []string{"--levels", "debug", "--levels", "warn"},
+			shouldError: true,
+		},
+		{
+			desc: "oneof invalid default value",
+			config: &struct {
+				Level string `oneof:"debug,info" default:"warn"`
+			}{},
+			shouldPanic: true,
+		},
+		{
+			desc: "fallback",
+			config: &struct {
+				Timeout     int `default:"30"`
+				ReadTimeout int `id:"read-timeout" fallback:"timeout" default:"5"`
+				Server      struct {
+					WriteTimeout int `id:"write-timeout" fallback:"read-timeout"`
+					Other        int `fallback:"write-timeout"`
+				}
+			}{},
+			conf: Conf{EnvDisable: true, FileDisable: true},
+			args: []string{"--timeout", "10", "--server.other", "3"},
+			validate: func(t *testing.T, config interface{}) {
+				c, success := config.(*struct {
+					Timeout     int `default:"30"`
+					ReadTimeout int `id:"read-timeout" fallback:"timeout" default:"5"`
+					Server      struct {
+						WriteTimeout int `id:"write-timeout" fallback:"read-timeout"`
+						Other        int `fallback:"write-timeout"`
+					}
+				})
+				require.True(t, success)
+
+				assert.Equal(t, 10, c.ReadTimeout)
+				assert.Equal(t, 10, c.Server.WriteTimeout)
+				assert.Equal(t, 3, c.Server.Other)
+			},
+		},
+		{
+			desc: "fallback cycle",
+			config: &struct {
+				A int `fallback:"c"`
+				B int `fallback:"a"`
+				C int `fallback:"b"`
+			}{},
+			shouldPanic: true,
+		},
+		{
+			desc: "fallback unknown variable",
+			config: &struct {
+				A int `fallback:"b"`
+			}{},
+			shouldPanic: true,
+		},
+		{
+			desc: "invalid assertion",
+			config: &struct {
+				V int `assert:"v > "`
+			}{},
+			shouldPanic: true,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
+			if tc.args != nil {
+				requireFlags(t)
+			}
 			setOS(tc.args, tc.env)
 
 			// Write config file.
@@ -708,6 +942,8 @@ func TestFindConfigFile_NoVariable(t *testing.T) {
 }
 
 func TestFindConfigFile_WithFlag(t *testing.T) {
+	requireFlags(t)
+
 	setOS([]string{"--configfile", "fromflag.conf"}, nil)
 	s := &setup{
 		conf: &Conf{
@@ -810,6 +1046,8 @@ func TestLoadRawFile_NoDecoder(t *testing.T) {
 }
 
 func TestLoadWithRawFile(t *testing.T) {
+	requireFlags(t)
+
 	fileContent := []byte(`{
 		"stringvar": "stringvalue",
 		"uintvar": 43
@@ -825,3 +1063,1612 @@ func TestLoadWithRawFile(t *testing.T) {
 	assert.EqualValues(t, "stringvalue", config.StringVar)
 	assert.EqualValues(t, 44, config.UintVar)
 }
+
+func TestLoad_EnvFile(t *testing.T) {
+	requireFlags(t)
+
+	file, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = file.WriteString("# comment\n" +
+		"PREF_V1=fromfile\n" +
+		"\n" +
+		"PREF_V2=fromfile\n" +
+		"PREF_V3\n")
+	require.NoError(t, err)
+
+	setOS([]string{"--env-file", file.Name()}, map[string]string{
+		"PREF_V2": "fromenv",
+		"PREF_V3": "fromenv",
+	})
+	config := &struct {
+		V1 string
+		V2 string
+		V3 string
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		EnvPrefix:   "PREF_",
+		EnvFileFlag: "env-file",
+	}))
+
+	assert.Equal(t, "fromfile", config.V1)
+	assert.Equal(t, "fromenv", config.V2)
+	assert.Equal(t, "fromenv", config.V3)
+}
+
+func TestParseEnvFile_InvalidKey(t *testing.T) {
+	_, err := parseEnvFile([]byte("INVALID KEY=value\n"))
+	assert.Error(t, err)
+}
+
+func TestLoad_SecretResolver(t *testing.T) {
+	requireFlags(t)
+
+	resolver := func(ref string) (string, error) {
+		if !strings.HasPrefix(ref, "file:") {
+			return "", errors.New("unknown reference " + ref)
+		}
+		return "resolved:" + strings.TrimPrefix(ref, "file:"), nil
+	}
+
+	setOS([]string{"--token", "file:/token"}, map[string]string{
+		"PASSWORD": "file:/password",
+		"PLAIN":    "file:/plain",
+	})
+	config := &struct {
+		Password string `secret:"true"`
+		Token    string `secret:"true"`
+		Plain    string
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable:    true,
+		SecretResolver: resolver,
+	}))
+
+	assert.Equal(t, "resolved:/password", config.Password)
+	assert.Equal(t, "resolved:/token", config.Token)
+	assert.Equal(t, "file:/plain", config.Plain)
+
+	setOS(nil, map[string]string{"PASSWORD": "vault:kv"})
+	assert.Error(t, Load(config, Conf{
+		FileDisable:    true,
+		SecretResolver: resolver,
+	}))
+}
+
+func TestLoad_Conflicts(t *testing.T) {
+	requireFlags(t)
+
+	fileContent := []byte(`{"v1": 1, "v2": 2, "v3": 3}`)
+
+	setOS([]string{"--v1", "10", "--v3", "3"}, map[string]string{
+		"V1": "5",
+		"V2": "20",
+	})
+	config := &struct {
+		V1 int
+		V2 int
+		V3 int
+		V4 int `default:"4"`
+	}{}
+	var conflicts []Conflict
+	require.NoError(t, LoadWithRawFile(config, fileContent, Conf{
+		FileDecoder: DecoderJSON,
+		Conflicts:   &conflicts,
+	}))
+
+	assert.Equal(t, []Conflict{
+		{"v1", SourceFile, 1, SourceEnv, 5},
+		{"v2", SourceFile, 2, SourceEnv, 20},
+		{"v1", SourceEnv, 5, SourceFlag, 10},
+	}, conflicts)
+}
+
+func TestLoad_DotEnv(t *testing.T) {
+	file, err := ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = file.WriteString("# comment\n" +
+		"export PREF_V1=fromdotenv # comment\n" +
+		"PREF_V2='single quoted'\n" +
+		"PREF_V3=\"double\\nquoted\"\n" +
+		"PREF_V4=fromdotenv\n")
+	require.NoError(t, err)
+
+	setOS(nil, map[string]string{"PREF_V4": "fromenv"})
+	config := &struct {
+		V1 string
+		V2 string
+		V3 string
+		V4 string
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		EnvPrefix:   "PREF_",
+		DotEnvFile:  file.Name(),
+	}))
+
+	assert.Equal(t, "fromdotenv", config.V1)
+	assert.Equal(t, "single quoted", config.V2)
+	assert.Equal(t, "double\nquoted", config.V3)
+	assert.Equal(t, "fromenv", config.V4)
+
+	assert.Error(t, Load(config, Conf{
+		FileDisable: true,
+		DotEnvFile:  "/doesntexist.env",
+	}))
+
+	// Neither the dotenv file nor the config file it points to are used when
+	// the environment is disabled.
+	file, err = ioutil.TempFile("", "gonfig")
+	require.NoError(t, err)
+	_, err = file.WriteString("CONFIG=/doesntexist.json\n")
+	require.NoError(t, err)
+
+	setOS(nil, nil)
+	withConfig := &struct {
+		Config string
+	}{}
+	require.NoError(t, Load(withConfig, Conf{
+		ConfigFileVariable: "config",
+		EnvDisable:         true,
+		DotEnvFile:         file.Name(),
+	}))
+	require.Error(t, Load(withConfig, Conf{
+		ConfigFileVariable: "config",
+		DotEnvFile:         file.Name(),
+	}))
+	assert.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		DotEnvFile:  "/doesntexist.env",
+	}))
+}
+
+func TestLoad_OneOfErrorNamesSource(t *testing.T) {
+	setOS(nil, map[string]string{"LEVEL": "warn"})
+	err := Load(&struct {
+		Level string `oneof:"debug,info"`
+	}{}, Conf{FileDisable: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be one of [debug, info]")
+	assert.Contains(t, err.Error(), "(env)")
+}
+
+func TestLoad_ParseError(t *testing.T) {
+	setOS(nil, map[string]string{"PORT": "eighty"})
+	err := Load(&struct {
+		Port int
+	}{}, Conf{FileDisable: true})
+	require.Error(t, err)
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, "port", parseErr.Option)
+	assert.Equal(t, SourceEnv, parseErr.Source)
+	assert.Equal(t, "eighty", parseErr.Raw)
+	assert.NotNil(t, parseErr.Err)
+
+	err = LoadRawFile(&struct {
+		Nested struct {
+			Port int
+		}
+	}{}, []byte(`{"nested": {"port": "eighty"}}`), Conf{FileDecoder: DecoderJSON})
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, "nested.port", parseErr.Option)
+	assert.Equal(t, SourceFile, parseErr.Source)
+}
+
+func TestLoad_ParseErrorSecretRedacted(t *testing.T) {
+	setOS(nil, map[string]string{"PIN": "hunter2"})
+	err := Load(&struct {
+		Pin int `secret:"true"`
+	}{}, Conf{FileDisable: true})
+
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.Empty(t, parseErr.Raw)
+	assert.NotContains(t, err.Error(), "hunter2")
+	assert.Contains(t, err.Error(), "failed to parse secret value into type int")
+}
+
+func TestLoad_Required(t *testing.T) {
+	type Config struct {
+		Host string `required:"true"`
+		Port int    `required:"true" default:"80"`
+	}
+
+	setOS(nil, nil)
+	err := Load(&Config{}, Conf{FileDisable: true})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrMissingRequired))
+	assert.Contains(t, err.Error(), "host")
+
+	setOS(nil, map[string]string{"HOST": "localhost"})
+	assert.NoError(t, Load(&Config{}, Conf{FileDisable: true}))
+}
+
+func TestLoad_CustomFileNotFound(t *testing.T) {
+	requireFlags(t)
+
+	setOS([]string{"--file", "/doesntexist.conf"}, nil)
+	err := Load(&struct {
+		File string
+	}{}, Conf{ConfigFileVariable: "file"})
+
+	var notFound *FileNotFoundError
+	require.True(t, errors.As(err, &notFound))
+	assert.Equal(t, []string{"/doesntexist.conf"}, notFound.Paths)
+}
+
+func TestLoad_Fallback(t *testing.T) {
+	conf := Conf{FileDisable: true, FlagDisable: true}
+
+	// Fallbacks require identical types.
+	assert.Panics(t, func() {
+		Load(&struct {
+			Port int    `default:"80"`
+			Addr string `fallback:"port"`
+		}{}, conf)
+	})
+
+	// The own default value is used when the fallback is not provided.
+	type timeouts struct {
+		Timeout int `default:"30"`
+		Read    int `fallback:"timeout" default:"5"`
+		Write   int `fallback:"timeout"`
+	}
+	setOS(nil, nil)
+	c1 := &timeouts{}
+	require.NoError(t, Load(c1, conf))
+	assert.Equal(t, 5, c1.Read)
+	assert.Equal(t, 30, c1.Write)
+
+	setOS(nil, map[string]string{"TIMEOUT": "10"})
+	c1 = &timeouts{}
+	require.NoError(t, Load(c1, conf))
+	assert.Equal(t, 10, c1.Read)
+	assert.Equal(t, 10, c1.Write)
+
+	// Slices are copied.
+	setOS(nil, map[string]string{"A": "x,y"})
+	c2 := &struct {
+		A []string
+		B []string `fallback:"a"`
+	}{}
+	require.NoError(t, Load(c2, conf))
+	c2.B[0] = "z"
+	assert.Equal(t, []string{"x", "y"}, c2.A)
+	assert.Equal(t, []string{"z", "y"}, c2.B)
+
+	// Fallback values are normalized and validated.
+	setOS(nil, map[string]string{"MODE": "DEBUG"})
+	c3 := &struct {
+		Mode  string
+		Level string `fallback:"mode" normalize:"lower"`
+	}{}
+	require.NoError(t, Load(c3, conf))
+	assert.Equal(t, "debug", c3.Level)
+
+	setOS(nil, map[string]string{"TIMEOUT": "500"})
+	err := Load(&struct {
+		Timeout int
+		Read    int `fallback:"timeout" max:"100"`
+	}{}, conf)
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "read", validationErr.Option)
+}
+
+func TestLoad_Aliases(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Nested struct {
+			NewName string `aliases:"old-name,legacy_name"`
+		}
+	}
+
+	var warnings []string
+	conf := Conf{
+		FileDecoder: DecoderJSON,
+		WarnFunc: func(msg string) {
+			warnings = append(warnings, msg)
+		},
+	}
+
+	setOS(nil, nil)
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config,
+		[]byte(`{"nested": {"legacy_name": "file"}}`), conf))
+	assert.Equal(t, "file", config.Nested.NewName)
+
+	setOS(nil, map[string]string{"NESTED_OLD_NAME": "env"})
+	config = &Config{}
+	require.NoError(t, Load(config, conf))
+	assert.Equal(t, "env", config.Nested.NewName)
+
+	setOS([]string{"--nested.old-name", "flag"}, nil)
+	config = &Config{}
+	require.NoError(t, Load(config, conf))
+	assert.Equal(t, "flag", config.Nested.NewName)
+
+	require.Len(t, warnings, 3)
+	assert.Contains(t, warnings[0], "nested.legacy_name")
+	assert.Contains(t, warnings[1], "NESTED_OLD_NAME")
+	assert.Contains(t, warnings[2], "--nested.old-name")
+
+	// The new name takes precedence.
+	setOS([]string{"--nested.old-name", "old", "--nested.newname", "new"}, nil)
+	config = &Config{}
+	require.NoError(t, Load(config, conf))
+	assert.Equal(t, "new", config.Nested.NewName)
+}
+
+func TestLoad_Deprecated(t *testing.T) {
+	requireFlags(t)
+
+	var warnings []string
+	setOS([]string{"--old", "x"}, nil)
+	require.NoError(t, Load(&struct {
+		Old string `deprecated:"use --new"`
+		New string
+	}{}, Conf{
+		FileDisable: true,
+		WarnFunc: func(msg string) {
+			warnings = append(warnings, msg)
+		},
+	}))
+
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "use --new")
+}
+
+func TestLoad_Normalize(t *testing.T) {
+	requireFlags(t)
+
+	setOS([]string{"--tags", " b,A ,a, c"},
+		map[string]string{"LEVEL": " Warn "})
+	config := &struct {
+		Level string   `normalize:"trim,lower" oneof:"debug,warn"`
+		Tags  []string `normalize:"trim,lower,dedupe"`
+		Ports []int    `normalize:"dedupe" default:"80,80,443"`
+	}{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+
+	assert.Equal(t, "warn", config.Level)
+	assert.Equal(t, []string{"b", "a", "c"}, config.Tags)
+	assert.Equal(t, []int{80, 443}, config.Ports)
+}
+
+func TestLoad_NormalizeInvalid(t *testing.T) {
+	setOS(nil, nil)
+	assert.Panics(t, func() {
+		Load(&struct {
+			Port int `normalize:"lower"`
+		}{}, Conf{})
+	})
+	assert.Panics(t, func() {
+		Load(&struct {
+			Name string `normalize:"dedupe"`
+		}{}, Conf{})
+	})
+	assert.Panics(t, func() {
+		Load(&struct {
+			Name string `normalize:"reverse"`
+		}{}, Conf{})
+	})
+}
+
+func TestLoad_WindowsServiceUnsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("registry is available on Windows")
+	}
+
+	setOS(nil, nil)
+	err := Load(&struct{ V int }{}, Conf{
+		FileDisable:    true,
+		WindowsService: "myservice",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "myservice")
+}
+
+func TestLoad_SourceRestrictions(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Token   string `sources:"env"`
+		Routes  string `noflag:"true"`
+		Verbose bool   `nofile:"true"`
+	}
+
+	setOS(nil, map[string]string{"TOKEN": "abc", "VERBOSE": "true"})
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{"routes": "a"}`),
+		Conf{FileDecoder: DecoderJSON}))
+	assert.Equal(t, "abc", config.Token)
+	assert.Equal(t, "a", config.Routes)
+	assert.True(t, config.Verbose)
+
+	setOS([]string{"--token", "abc"}, nil)
+	assert.Error(t, Load(&Config{}, Conf{FileDisable: true}))
+
+	setOS([]string{"--routes", "a"}, nil)
+	assert.Error(t, Load(&Config{}, Conf{FileDisable: true}))
+
+	setOS(nil, nil)
+	err := LoadRawFile(&Config{}, []byte(`{"verbose": true}`),
+		Conf{FileDecoder: DecoderJSON})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can not be set from file")
+}
+
+func TestLoad_Sensitive(t *testing.T) {
+	type Config struct {
+		Host     string
+		Password string `sensitive:"true"`
+	}
+
+	setOS(nil, map[string]string{"PASSWORD": "hunter2"})
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{"host": "a"}`),
+		Conf{FileDecoder: DecoderJSON}))
+	assert.Equal(t, "hunter2", config.Password)
+
+	err := LoadWithRawFile(&Config{}, []byte(`{"password": "hunter2"}`),
+		Conf{FileDecoder: DecoderJSON})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "password is sensitive and must not be stored in the config file")
+	assert.NotContains(t, err.Error(), "hunter2")
+
+	assert.Panics(t, func() {
+		Load(&struct {
+			V string `sensitive:"true" default:"x"`
+		}{}, Conf{})
+	})
+	assert.Panics(t, func() {
+		Load(&struct {
+			V string `sensitive:"true" sources:"file,env"`
+		}{}, Conf{})
+	})
+}
+
+func TestLoad_FileProfiles(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Profile string
+		Host    string
+		Port    int `default:"80"`
+		DB      struct {
+			Name string
+			User string
+		}
+	}
+	content := []byte(`
+default:
+  host: localhost
+  db: {name: app, user: app}
+dev:
+  port: 8080
+prod:
+  host: example.com
+  db: {name: app_prod}
+eu:
+  host: eu.example.com
+`)
+
+	testCases := []struct {
+		args []string
+		env  map[string]string
+		conf Conf
+
+		host, dbName string
+		port         int
+	}{
+		{nil, nil, Conf{Profile: "dev"}, "localhost", "app", 8080},
+		{nil, nil, Conf{ProfileVariable: "profile"}, "localhost", "app", 80},
+		{[]string{"--profile", "prod"}, map[string]string{"PROFILE": "dev"},
+			Conf{Profile: "dev", ProfileVariable: "profile"},
+			"example.com", "app_prod", 80},
+		{nil, map[string]string{"PROFILE": "prod,eu"},
+			Conf{ProfileVariable: "profile"},
+			"eu.example.com", "app_prod", 80},
+	}
+	for _, tc := range testCases {
+		setOS(tc.args, tc.env)
+		config := &Config{}
+		tc.conf.FileDecoder = DecoderYAML
+		tc.conf.FileStrictUnknownKeys = true
+		require.NoError(t, LoadWithRawFile(config, content, tc.conf))
+		assert.Equal(t, tc.host, config.Host)
+		assert.Equal(t, tc.port, config.Port)
+		assert.Equal(t, tc.dbName, config.DB.Name)
+		assert.Equal(t, "app", config.DB.User)
+	}
+
+	setOS(nil, nil)
+	err := LoadWithRawFile(&Config{}, content,
+		Conf{FileDecoder: DecoderYAML, Profile: "staging"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile staging not found in config file")
+
+	// With multiple config files, the profiles can be defined in any of them.
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	base, override := path.Join(dir, "a.yaml"), path.Join(dir, "b.yaml")
+	require.NoError(t, ioutil.WriteFile(base, content, 0644))
+	require.NoError(t, ioutil.WriteFile(override,
+		[]byte("default:\n  db: {user: admin}\n"), 0644))
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{
+		FileDefaultFilenames: []string{base, override},
+		Profile:              "prod",
+	}))
+	assert.Equal(t, "example.com", config.Host)
+	assert.Equal(t, "app_prod", config.DB.Name)
+	assert.Equal(t, "admin", config.DB.User)
+
+	err = Load(&Config{}, Conf{
+		FileDefaultFilenames: []string{base, override},
+		Profile:              "staging",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profile staging not found in config file at "+
+		base+", "+override)
+}
+
+func TestLoad_FileStrictTypes(t *testing.T) {
+	type Config struct {
+		Name    string
+		Port    uint16
+		Ratio   float64
+		Debug   bool
+		Timeout time.Duration
+		Tags    []string
+		Server  struct {
+			Workers int
+		}
+	}
+
+	setOS(nil, nil)
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{"name": "a", "port": 80,
+		"ratio": 1, "debug": true, "timeout": "1m", "tags": ["x"],
+		"server": {"workers": 4}}`),
+		Conf{FileDecoder: DecoderJSON, FileStrictTypes: true}))
+	assert.Equal(t, uint16(80), config.Port)
+	assert.Equal(t, 4, config.Server.Workers)
+
+	testCases := []struct {
+		content string
+		err     string
+	}{
+		{"name: 42", `invalid value for name from file: expected string, got integer 42`},
+		{"port: 80.5", `invalid value for port from file: expected integer, got number 80.5`},
+		{"port: 70000", `invalid value for port from file: value 70000 overflows uint16`},
+		{"port: -1", `invalid value for port from file: value -1 overflows uint16`},
+		{`port: "80"`, `invalid value for port from file: expected integer, got string "80"`},
+		{`debug: "yes"`, `invalid value for debug from file: expected boolean, got string "yes"`},
+		{"tags: a,b", `invalid value for tags from file: expected list, got string "a,b"`},
+		{"tags: [a, 1]", `invalid value for tags from file: element 1: expected string, got integer 1`},
+		{"server: {workers: 2.5}", `invalid value for server.workers from file: expected integer, got number 2.5`},
+	}
+	for _, tc := range testCases {
+		err := LoadWithRawFile(&Config{}, []byte(tc.content),
+			Conf{FileDecoder: DecoderYAML, FileStrictTypes: true})
+		require.Error(t, err, tc.content)
+		assert.Contains(t, err.Error(), tc.err)
+	}
+
+	// Secret values are not part of the error.
+	err := LoadWithRawFile(&struct {
+		Pin int `secret:"true"`
+	}{}, []byte(`{"pin": "hunter2"}`),
+		Conf{FileDecoder: DecoderJSON, FileStrictTypes: true})
+	assert.EqualError(t, err, "error loading config vars from config file: "+
+		"invalid value for pin from file: expected integer, got string")
+
+	// Values are converted without FileStrictTypes.
+	require.NoError(t, LoadWithRawFile(config, []byte(`port: "8080"`),
+		Conf{FileDecoder: DecoderYAML}))
+	assert.Equal(t, uint16(8080), config.Port)
+}
+
+func TestLoad_SourcesUnknown(t *testing.T) {
+	setOS(nil, nil)
+	assert.Panics(t, func() {
+		Load(&struct {
+			V int `sources:"env,vault"`
+		}{}, Conf{})
+	})
+}
+
+func TestLoad_FDSource(t *testing.T) {
+	requireFlags(t)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString("# comment\nv1 = fromfd\nnested.v2=fromfd\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	fd := int(r.Fd())
+
+	setOS([]string{"--v3", "fromflag"}, map[string]string{
+		"V1": "fromenv",
+		"V3": "fromenv",
+	})
+	config := &struct {
+		V1     string
+		V3     string
+		Nested struct {
+			V2 string
+		}
+	}{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		FDSource:    fd,
+	}))
+	// The descriptor has been closed by gonfig.  Close r now, so that it
+	// does not close a reused descriptor when it is garbage collected.
+	r.Close()
+
+	assert.Equal(t, "fromfd", config.V1)
+	assert.Equal(t, "fromfd", config.Nested.V2)
+	assert.Equal(t, "fromflag", config.V3)
+
+	// The content of the file descriptor is kept for later loads.
+	config.V1 = ""
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		FDSource:    fd,
+	}))
+	assert.Equal(t, "fromfd", config.V1)
+
+	// The descriptor number, which is usually reused for the new pipe, is
+	// read again once forgotten.
+	ForgetFDSource(fd)
+	r, w, err = os.Pipe()
+	require.NoError(t, err)
+	fd = int(r.Fd())
+	_, err = w.WriteString("v1 = fromnewfd\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		FDSource:    fd,
+	}))
+	r.Close()
+	assert.Equal(t, "fromnewfd", config.V1)
+	ForgetFDSource(fd)
+}
+
+func TestLoadContext_FDSource(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	fd := int(r.Fd())
+
+	setOS(nil, nil)
+	config := &struct {
+		V string
+	}{}
+	conf := Conf{
+		FileDisable: true,
+		FDSource:    fd,
+	}
+
+	// The writer has not closed the pipe yet.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, LoadContext(ctx, config, conf))
+
+	_, err = w.WriteString("v = fromfd\n")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, Load(config, conf))
+	r.Close()
+	assert.Equal(t, "fromfd", config.V)
+	ForgetFDSource(fd)
+}
+
+func TestLoad_DNS(t *testing.T) {
+	type ctxKey struct{}
+	lookups := 0
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	lookup := func(lookupCtx context.Context, name string) ([]string, error) {
+		lookups++
+		require.Equal(t, "config.example.com", name)
+		require.Equal(t, "value", lookupCtx.Value(ctxKey{}))
+		return []string{"v1=fromdns", "nested.v2=fromdns", "v=spf1 -all",
+			"other=ignored"}, nil
+	}
+
+	setOS(nil, map[string]string{"V3": "fromenv"})
+	type testConfig struct {
+		V1     string
+		V3     string
+		Nested struct {
+			V2 string
+		}
+	}
+	conf := Conf{
+		FileDisable:  true,
+		DNSZone:      "config.example.com",
+		DNSLookupTXT: lookup,
+	}
+
+	for i := 0; i < 2; i++ {
+		config := &testConfig{}
+		require.NoError(t, LoadContext(ctx, config, conf))
+		assert.Equal(t, "fromdns", config.V1)
+		assert.Equal(t, "fromdns", config.Nested.V2)
+		assert.Equal(t, "fromenv", config.V3)
+	}
+	assert.Equal(t, 1, lookups)
+}
+
+func TestLoad_FlagArgs(t *testing.T) {
+	requireFlags(t)
+
+	setOS([]string{"--v", "fromosargs"}, nil)
+	config := &struct {
+		V string
+	}{}
+	var args []string
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		EnvDisable:  true,
+		FlagArgs:    []string{"first", "--v", "fromflagargs", "second"},
+		ArgsOut:     &args,
+	}))
+
+	assert.Equal(t, "fromflagargs", config.V)
+	assert.Equal(t, []string{"first", "second"}, args)
+}
+
+type defaulterConfig struct {
+	Workers int
+	Host    string `default:"static"`
+	Nested  struct {
+		Dir string
+	}
+}
+
+func (c *defaulterConfig) Default(id string) (string, bool) {
+	switch id {
+	case "host":
+		return "computed", true
+	case "nested.dir":
+		return "/home/user", true
+	}
+	return "", false
+}
+
+func TestLoad_ComputedDefaults(t *testing.T) {
+	requireFlags(t)
+
+	setOS(nil, nil)
+	config := &defaulterConfig{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.Equal(t, 0, config.Workers)
+	assert.Equal(t, "computed", config.Host)
+	assert.Equal(t, "/home/user", config.Nested.Dir)
+
+	var infos []OptionInfo
+	config = &defaulterConfig{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		DefaultFunc: func(opt OptionInfo) (string, bool) {
+			infos = append(infos, opt)
+			if opt.ID == "workers" {
+				return "4", true
+			}
+			return "", false
+		},
+	}))
+	assert.Equal(t, 4, config.Workers)
+	assert.Equal(t, "computed", config.Host)
+	require.Len(t, infos, 3)
+	assert.Equal(t, "host", infos[1].ID)
+	assert.Equal(t, "static", infos[1].Default)
+
+	setOS([]string{"--workers", "8"}, nil)
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.Equal(t, 8, config.Workers)
+}
+
+func TestLoad_ComputedDefaultsInvalid(t *testing.T) {
+	setOS(nil, nil)
+	config := &struct {
+		Mode    string `oneof:"a,b"`
+		Workers int
+	}{}
+
+	err := Load(config, Conf{
+		FileDisable: true,
+		DefaultFunc: func(opt OptionInfo) (string, bool) {
+			if opt.ID == "mode" {
+				return "zzz", true
+			}
+			return "", false
+		},
+	})
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr), "got %v", err)
+	assert.Equal(t, "mode", validationErr.Option)
+	assert.Equal(t, SourceDefault, validationErr.Source)
+
+	err = Load(config, Conf{
+		FileDisable: true,
+		DefaultFunc: func(opt OptionInfo) (string, bool) {
+			if opt.ID == "workers" {
+				return "many", true
+			}
+			return "", false
+		},
+	})
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr), "got %v", err)
+	assert.Equal(t, "workers", parseErr.Option)
+	assert.Equal(t, SourceDefault, parseErr.Source)
+
+	static := &struct {
+		Mode string `oneof:"a,b" default:"zzz"`
+	}{}
+	assert.Panics(t, func() {
+		Load(static, Conf{FileDisable: true})
+	})
+}
+
+func TestLoadContext_CustomSources(t *testing.T) {
+	setOS(nil, map[string]string{"V2": "fromenv"})
+	config := &struct {
+		V1     string
+		V2     string
+		Nested struct {
+			V3 int
+		}
+	}{}
+
+	type ctxKey struct{}
+	var received context.Context
+	ctx := context.WithValue(context.Background(), ctxKey{}, "marker")
+	require.NoError(t, LoadContext(ctx, config, Conf{
+		FileDisable: true,
+		CustomSources: []CustomSource{
+			CustomSourceFunc(func(ctx context.Context) (map[string]interface{}, error) {
+				received = ctx
+				return map[string]interface{}{
+					"v1":     "fromcustom",
+					"v2":     "fromcustom",
+					"nested": map[string]interface{}{"v3": 3},
+				}, nil
+			}),
+		},
+	}))
+
+	assert.Equal(t, "fromcustom", config.V1)
+	assert.Equal(t, "fromenv", config.V2)
+	assert.Equal(t, 3, config.Nested.V3)
+	assert.Equal(t, "marker", received.Value(ctxKey{}))
+}
+
+func TestLoadContext_Canceled(t *testing.T) {
+	setOS(nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	called := false
+	err := LoadContext(ctx, &struct{ V string }{}, Conf{
+		FileDisable: true,
+		CustomSources: []CustomSource{
+			CustomSourceFunc(func(ctx context.Context) (map[string]interface{}, error) {
+				cancel()
+				return nil, nil
+			}),
+			CustomSourceFunc(func(ctx context.Context) (map[string]interface{}, error) {
+				called = true
+				return nil, nil
+			}),
+		},
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called)
+}
+
+func TestLoad_Validation(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Port  int      `min:"1" max:"65535"`
+		Ports []int    `min:"1" max:"65535"`
+		Hosts []string `pattern:"^[a-z.]+$" required:"true"`
+		Ratio float64  `max:"1"`
+	}
+
+	setOS(nil, nil)
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(
+		`{"port": 80, "ports": [80, 443], "hosts": ["a.com"], "ratio": 0.5}`),
+		Conf{FileDecoder: DecoderJSON}))
+
+	testCases := []struct {
+		content string
+		option  string
+		reason  string
+	}{
+		{`{"port": 0}`, "port", "out of range"},
+		{`{"ports": [80, 443, 70000]}`, "ports[2]", "greater than 65535"},
+		{`{"hosts": ["a.com", "B.com"]}`, "hosts[1]", "does not match pattern"},
+		{`{"hosts": ["a.com", ""]}`, "hosts[1]", "empty element"},
+		{`{"ratio": 1.5}`, "ratio", "out of range"},
+	}
+	for _, tc := range testCases {
+		err := LoadWithRawFile(&Config{}, []byte(tc.content),
+			Conf{FileDecoder: DecoderJSON})
+
+		var validationErr *ValidationError
+		require.True(t, errors.As(err, &validationErr), tc.content)
+		assert.Equal(t, tc.option, validationErr.Option)
+		assert.Equal(t, SourceFile, validationErr.Source)
+		assert.Contains(t, validationErr.Reason, tc.reason)
+	}
+
+	setOS([]string{"--ports", "80,0"}, nil)
+	err := Load(&Config{}, Conf{FileDisable: true})
+	require.Error(t, err)
+	assert.Equal(t, "ports[1]: out of range: value '0' is less than 1 (flag)",
+		err.Error())
+}
+
+func TestParseFile_ValidationErrorNamesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	filename := path.Join(dir, "app.json")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"port": 0}`), 0644))
+
+	setOS(nil, nil)
+	err = Load(&struct {
+		Port int `min:"1"`
+	}{}, Conf{FileDefaultFilename: filename})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port: out of range")
+	assert.Contains(t, err.Error(), "(file: "+filename+")")
+}
+
+func TestLoad_ValidationInvalidTags(t *testing.T) {
+	setOS(nil, nil)
+	assert.Panics(t, func() {
+		Load(&struct {
+			Name string `min:"1"`
+		}{}, Conf{})
+	})
+	assert.Panics(t, func() {
+		Load(&struct {
+			Port int `pattern:"^1"`
+		}{}, Conf{})
+	})
+	assert.Panics(t, func() {
+		Load(&struct {
+			Name string `pattern:"("`
+		}{}, Conf{})
+	})
+}
+
+func TestLoad_Timings(t *testing.T) {
+	setOS([]string{"--v", "1"}, nil)
+	var timings LoadTimings
+	var warnings []string
+	require.NoError(t, LoadWithRawFile(&struct{ V int }{}, []byte(`{"v": 2}`), Conf{
+		FileDecoder:   DecoderJSON,
+		Timings:       &timings,
+		StartupBudget: time.Nanosecond,
+		WarnFunc: func(msg string) {
+			warnings = append(warnings, msg)
+		},
+	}))
+
+	var phases []string
+	for _, phase := range timings.Phases {
+		phases = append(phases, phase.Phase)
+	}
+	assert.Equal(t, []string{PhaseInspect, PhaseFileDecode, "env", "flag",
+		PhaseValidate}, phases)
+	assert.True(t, timings.Total > 0)
+
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "exceeding the startup budget of 1ns")
+}
+
+func TestLoadMulti(t *testing.T) {
+	requireFlags(t)
+
+	type DBConfig struct {
+		DB struct {
+			Host string `default:"localhost"`
+		}
+	}
+	type HTTPConfig struct {
+		Port int `short:"p"`
+	}
+
+	setOS([]string{"-p", "8080"}, map[string]string{"DB_HOST": "db"})
+	db, http := &DBConfig{}, &HTTPConfig{}
+	require.NoError(t, LoadMulti(Conf{}, db, http))
+	assert.Equal(t, "db", db.DB.Host)
+	assert.Equal(t, 8080, http.Port)
+
+	assert.PanicsWithError(t,
+		"error in config structure: duplicate config variable: port", func() {
+			LoadMulti(Conf{}, http, &HTTPConfig{})
+		})
+	assert.PanicsWithError(t,
+		"error in config structure: duplicate config variable shorthand: p",
+		func() {
+			LoadMulti(Conf{}, http, &struct {
+				Path string `short:"p"`
+			}{})
+		})
+}
+
+func TestLoad_PointerFields(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Port    *int `min:"0"`
+		Host    *string
+		Verbose *bool
+		Debug   *bool
+		Names   *[]string `normalize:"upper"`
+		Limit   *int      `default:"10"`
+		Retries *int
+	}
+
+	setOS([]string{"--verbose", "--host", "example.com"},
+		map[string]string{"NAMES": "a,b"})
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{"port": 0}`),
+		Conf{FileDecoder: DecoderJSON}))
+
+	require.NotNil(t, config.Port)
+	assert.Equal(t, 0, *config.Port)
+	require.NotNil(t, config.Host)
+	assert.Equal(t, "example.com", *config.Host)
+	require.NotNil(t, config.Verbose)
+	assert.True(t, *config.Verbose)
+	assert.Nil(t, config.Debug)
+	require.NotNil(t, config.Names)
+	assert.Equal(t, []string{"A", "B"}, *config.Names)
+	require.NotNil(t, config.Limit)
+	assert.Equal(t, 10, *config.Limit)
+	assert.Nil(t, config.Retries)
+
+	setOS(nil, map[string]string{"PORT": "-1"})
+	err := Load(&Config{}, Conf{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "port: out of range")
+}
+
+func TestLoad_StructSlices(t *testing.T) {
+	requireFlags(t)
+
+	type Upstream struct {
+		Host string `required:"true"`
+		Port int    `default:"80" max:"65535"`
+	}
+	type Config struct {
+		Upstreams []Upstream
+		Backends  []*Upstream
+	}
+
+	setOS(nil, map[string]string{
+		"UPSTREAMS_0_PORT": "8080",
+		"UPSTREAMS_2_HOST": "c",
+		"BACKENDS_0_HOST":  "d",
+	})
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{"upstreams": [
+		{"host": "a"},
+		{"host": "b", "port": 81}
+	]}`), Conf{
+		FileDecoder:           DecoderJSON,
+		FileStrictUnknownKeys: true,
+	}))
+
+	assert.Equal(t, []Upstream{
+		{Host: "a", Port: 8080},
+		{Host: "b", Port: 81},
+		{Host: "c", Port: 80},
+	}, config.Upstreams)
+	require.Len(t, config.Backends, 1)
+	assert.Equal(t, Upstream{Host: "d", Port: 80}, *config.Backends[0])
+
+	setOS(nil, nil)
+	for content, expected := range map[string]string{
+		`{"upstreams": [{"host": "a"}, {"host": "b", "port": 99999}]}`: "upstreams[1].port: out of range",
+		`{"upstreams": [{"port": 1}]}`:                                 "upstreams[0].host",
+		`{"upstreams": [{"host": "a", "prot": 1}]}`:                    "upstreams[0].prot",
+		`{"upstreams": {"host": "a"}}`:                                 "list of structs config var upstreams",
+	} {
+		err := LoadRawFile(&Config{}, []byte(content), Conf{
+			FileDecoder:           DecoderJSON,
+			FileStrictUnknownKeys: true,
+		})
+		require.Error(t, err, content)
+		assert.Contains(t, err.Error(), expected, content)
+	}
+
+	setOS(nil, map[string]string{"UPSTREAMS_0_PORT": "1"})
+	err := Load(&Config{}, Conf{})
+	assert.True(t, errors.Is(err, ErrMissingRequired))
+	assert.Contains(t, err.Error(), "upstreams[0].host")
+
+	setOS([]string{"--upstreams", "a"}, nil)
+	assert.Error(t, Load(&Config{}, Conf{}))
+
+	assert.PanicsWithError(t, "error in config structure: short tag not "+
+		"supported for list[].v in a list of structs", func() {
+		Load(&struct {
+			List []struct {
+				V string `short:"v"`
+			}
+		}{}, Conf{})
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Port int
+		Host string `required:"true"`
+	}
+	load := func(args []string, env map[string]string, conf Conf) error {
+		setOS(args, env)
+		conf.FileDisable = conf.FileDefaultFilename == ""
+		return Load(&Config{}, conf)
+	}
+
+	assert.Equal(t, ExitOK, ExitCode(nil))
+	assert.Equal(t, ExitOK, ExitCode(load([]string{"--host", "h"}, nil, Conf{})))
+
+	err := load([]string{"--unknown"}, nil, Conf{})
+	assert.Equal(t, ExitUsage, ExitCode(err))
+	err = load([]string{"--host", "h", "--port", "x"}, nil, Conf{})
+	assert.Equal(t, ExitUsage, ExitCode(err))
+
+	var buf bytes.Buffer
+	writeError(&buf, err)
+	assert.Contains(t, buf.String(), "--port")
+	assert.Contains(t, buf.String(), "--help' for usage.")
+
+	err = load(nil, map[string]string{"HOST": "h", "PORT": "x"}, Conf{})
+	assert.Equal(t, ExitConfig, ExitCode(err))
+	buf.Reset()
+	writeError(&buf, err)
+	assert.NotContains(t, buf.String(), "for usage")
+
+	err = load(nil, nil, Conf{})
+	assert.Equal(t, ExitConfig, ExitCode(err))
+
+	err = load(nil, nil, Conf{
+		FileDefaultFilename: "/nonexistent/config.json",
+		FileRequired:        true,
+	})
+	assert.Equal(t, ExitNoInput, ExitCode(err))
+
+	err = load(nil, nil, Conf{CustomSources: []CustomSource{
+		CustomSourceFunc(func(ctx context.Context) (map[string]interface{}, error) {
+			return nil, errors.New("connection refused")
+		}),
+	}})
+	assert.Equal(t, ExitUnavailable, ExitCode(err))
+	assert.Contains(t, err.Error(), "connection refused")
+
+	assert.Equal(t, ExitError, ExitCode(errors.New("other")))
+}
+
+func TestLoad_AliasTable(t *testing.T) {
+	RegisterAliases(map[string]string{
+		"db_url":        "database.url",
+		"legacy.db.pwd": "database.password",
+		"LOGLEVEL":      "log.level",
+		"other":         "not.an.option",
+	})
+	defer func() {
+		aliasTable = make(map[string]string)
+	}()
+
+	type Config struct {
+		Database struct {
+			URL      string
+			Password string
+		}
+		Log struct {
+			Level string
+		}
+		Other string
+	}
+
+	var warnings []string
+	conf := Conf{
+		FileDecoder: DecoderJSON,
+		WarnFunc: func(msg string) {
+			warnings = append(warnings, msg)
+		},
+	}
+
+	setOS(nil, map[string]string{"LOGLEVEL": "debug"})
+	config := &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{
+		"db_url": "postgres://db",
+		"legacy": {"db": {"pwd": "secret"}},
+		"other": "value"
+	}`), conf))
+	assert.Equal(t, "postgres://db", config.Database.URL)
+	assert.Equal(t, "secret", config.Database.Password)
+	assert.Equal(t, "debug", config.Log.Level)
+	assert.Equal(t, "value", config.Other)
+	assert.Contains(t, warnings,
+		"config key db_url (from file) is deprecated, use database.url instead")
+	assert.Contains(t, warnings,
+		"environment variable LOGLEVEL is deprecated, use LOG_LEVEL instead")
+
+	// The config variable's own keys and environment variables take precedence.
+	setOS(nil, map[string]string{"LOGLEVEL": "debug", "LOG_LEVEL": "info"})
+	config = &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{
+		"db_url": "postgres://old",
+		"database": {"url": "postgres://new"}
+	}`), Conf{FileDecoder: DecoderJSON}))
+	assert.Equal(t, "postgres://new", config.Database.URL)
+	assert.Equal(t, "info", config.Log.Level)
+
+	// The nested maps of moved legacy keys are not unknown keys.
+	config = &Config{}
+	require.NoError(t, LoadWithRawFile(config, []byte(`{
+		"legacy": {"db": {"pwd": "secret"}}
+	}`), Conf{FileDecoder: DecoderJSON, FileStrictUnknownKeys: true}))
+	assert.Equal(t, "secret", config.Database.Password)
+}
+
+func TestAsEnviron(t *testing.T) {
+	type Config struct {
+		Port     int
+		Hosts    []string
+		Ratio    float64
+		Limit    ByteSize
+		Key      []byte
+		Verbose  *bool
+		Password string `secret:"true"`
+		Internal string `sources:"file"`
+		Server   struct {
+			Name string
+		}
+		Upstreams []struct {
+			Addr string
+		}
+	}
+
+	config := &Config{
+		Port:     8080,
+		Hosts:    []string{"a", "b,c"},
+		Ratio:    0.5,
+		Limit:    512 * MiB,
+		Key:      []byte{1, 2},
+		Password: "hunter2",
+		Internal: "x",
+	}
+	config.Server.Name = "srv"
+	config.Upstreams = append(config.Upstreams, struct{ Addr string }{"up:80"})
+
+	env, err := AsEnviron(config, Conf{EnvPrefix: "APP_"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"APP_PORT=8080",
+		`APP_HOSTS=a,"b,c"`,
+		"APP_RATIO=0.5",
+		"APP_LIMIT=512MiB",
+		"APP_KEY=AQI=",
+		"APP_SERVER_NAME=srv",
+		"APP_UPSTREAMS_0_ADDR=up:80",
+	}, env)
+
+	env, err = AsEnviron(config, Conf{EnvExportSecrets: true})
+	require.NoError(t, err)
+	assert.Contains(t, env, "PASSWORD=hunter2")
+
+	// The exported variables load the same configuration.
+	vars := make(map[string]string)
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		vars[parts[0]] = parts[1]
+	}
+	setOS(nil, vars)
+	loaded := &Config{}
+	require.NoError(t, Load(loaded, Conf{FileDisable: true}))
+	loaded.Internal = config.Internal
+	assert.Equal(t, config, loaded)
+
+	_, err = AsEnviron(&struct {
+		Value FailingMarshaler
+	}{}, Conf{})
+	assert.EqualError(t, err, "error formatting value: "+
+		"failed to marshal value of type gonfig.FailingMarshaler: error")
+}
+
+func TestLoad_FlagNegationAndCount(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Color     bool `default:"true"`
+		Verbose   int  `short:"v" count:"true"`
+		Cache     *bool
+		Confirm   bool
+		NoConfirm bool `id:"no-confirm"`
+	}
+
+	setOS([]string{"--no-color", "-v", "-v", "-v", "--no-cache"}, nil)
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.False(t, config.Color)
+	assert.Equal(t, 3, config.Verbose)
+	require.NotNil(t, config.Cache)
+	assert.False(t, *config.Cache)
+
+	// The last of a flag and its negation wins.
+	setOS([]string{"--no-color", "--color", "-vv"}, nil)
+	config = &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.True(t, config.Color)
+	assert.Equal(t, 2, config.Verbose)
+	assert.Nil(t, config.Cache)
+
+	// An existing flag with the name of a negation is left alone.
+	setOS([]string{"--no-confirm"}, nil)
+	config = &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.True(t, config.NoConfirm)
+	assert.False(t, config.Confirm)
+
+	// Counts can also be set from other sources.
+	setOS(nil, map[string]string{"VERBOSE": "2"})
+	config = &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.Equal(t, 2, config.Verbose)
+
+	assert.Panics(t, func() {
+		Load(&struct {
+			V string `count:"true"`
+		}{}, Conf{})
+	})
+}
+
+func TestLoad_FlagSingleDash(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Output  string
+		Name    string `short:"n"`
+		Verbose int    `short:"v" count:"true"`
+		Color   bool   `default:"true"`
+	}
+
+	setOS(nil, nil)
+	var args []string
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable:    true,
+		FlagSingleDash: true,
+		FlagArgs: []string{"-output", "out.txt", "-name=x", "-vvv",
+			"-no-color", "pos", "--", "-output"},
+		ArgsOut: &args,
+	}))
+	assert.Equal(t, "out.txt", config.Output)
+	assert.Equal(t, "x", config.Name)
+	assert.Equal(t, 3, config.Verbose)
+	assert.False(t, config.Color)
+	assert.Equal(t, []string{"pos", "-output"}, args)
+
+	// Values of flags are left as is.
+	for _, flagArgs := range [][]string{
+		{"--name", "-output"}, {"-name", "-output"}, {"-n", "-output"},
+	} {
+		config = &Config{}
+		require.NoError(t, Load(config, Conf{
+			FileDisable:    true,
+			FlagSingleDash: true,
+			FlagArgs:       flagArgs,
+		}))
+		assert.Equal(t, "-output", config.Name, flagArgs)
+		assert.Equal(t, "", config.Output, flagArgs)
+	}
+
+	// Without FlagSingleDash, -name=x is the shorthand -n with value "ame=x".
+	config = &Config{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable: true,
+		FlagArgs:    []string{"-name=x"},
+	}))
+	assert.Equal(t, "ame=x", config.Name)
+}
+
+func TestLoad_Interpolate(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		DataDir string `id:"data_dir" default:"/var/lib/app"`
+		LogFile string `id:"log_file" default:"${data_dir}/app.log"`
+		Port    int    `default:"80"`
+		URL     string `default:"http://localhost:${port}/${server.path}"`
+		Dirs    []string
+		Literal string `default:"$${data_dir}"`
+		Server  struct {
+			Path string `default:"api"`
+			Root string `default:"${path}/v1"`
+		}
+	}
+
+	setOS([]string{"--data_dir", "/data", "--dirs", "${data_dir}/a,${log_file}"},
+		map[string]string{"PORT": "8080"})
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true, Interpolate: true}))
+	assert.Equal(t, "/data/app.log", config.LogFile)
+	assert.Equal(t, "http://localhost:8080/api", config.URL)
+	assert.Equal(t, []string{"/data/a", "/data/app.log"}, config.Dirs)
+	assert.Equal(t, "${data_dir}", config.Literal)
+	assert.Equal(t, "api/v1", config.Server.Root)
+
+	// Without Interpolate, values are used as is.
+	config = &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.Equal(t, "${data_dir}/app.log", config.LogFile)
+
+	testCases := []struct {
+		env map[string]string
+		err string
+	}{
+		{
+			map[string]string{"DATA_DIR": "${log_file}"},
+			"interpolation cycle detected: data_dir -> log_file -> data_dir",
+		},
+		{
+			map[string]string{"URL": "${unknown}"},
+			"unknown config variable unknown referred to by url",
+		},
+		{
+			map[string]string{"URL": "${server}"},
+			"config variable server referred to by url must have a simple value",
+		},
+	}
+	for _, tc := range testCases {
+		setOS(nil, tc.env)
+		err := Load(&Config{}, Conf{FileDisable: true, Interpolate: true})
+		assert.EqualError(t, err, tc.err)
+	}
+
+	setOS(nil, map[string]string{"URL": "${token}"})
+	err := Load(&struct {
+		URL   string
+		Token string `secret:"true"`
+	}{}, Conf{FileDisable: true, Interpolate: true})
+	assert.EqualError(t, err, "secret config variable token can only be "+
+		"referred to by secret config variables, not by url")
+}
+
+func TestLoadSection(t *testing.T) {
+	requireFlags(t)
+
+	type ServerConfig struct {
+		Host string `default:"localhost"`
+		Port int
+		TLS  struct {
+			Cert string
+		}
+	}
+
+	file := []byte(`{
+		"server": {"port": 80, "tls": {"cert": "a.pem"}},
+		"metrics": {"port": 9090},
+		"services": {"api": {"host": "api"}}
+	}`)
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(filename, file, 0644))
+
+	var unknown []string
+	conf := Conf{
+		FileDefaultFilename: filename,
+		FileDecoder:         DecoderJSON,
+		UnknownKeyWarning: func(key string) {
+			unknown = append(unknown, key)
+		},
+	}
+
+	setOS([]string{"--server.host", "example.com"},
+		map[string]string{"APP_SERVER_TLS_CERT": "b.pem"})
+	config := &ServerConfig{}
+	conf.EnvPrefix = "APP_"
+	require.NoError(t, LoadSection(config, "server", conf))
+	assert.Equal(t, "example.com", config.Host)
+	assert.Equal(t, 80, config.Port)
+	assert.Equal(t, "b.pem", config.TLS.Cert)
+	assert.Empty(t, unknown)
+
+	// Sections can be nested.
+	setOS(nil, nil)
+	config = &ServerConfig{}
+	require.NoError(t, LoadSection(config, "services.api", conf))
+	assert.Equal(t, "api", config.Host)
+	assert.Equal(t, 0, config.Port)
+
+	// Unknown keys are reported within the section only.
+	require.NoError(t, ioutil.WriteFile(filename,
+		[]byte(`{"server": {"port": 80, "other": 1}, "metrics": {}}`), 0644))
+	require.NoError(t, LoadSection(&ServerConfig{}, "server", conf))
+	assert.Equal(t, []string{"server.other"}, unknown)
+}
+
+func TestLoad_DirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gonfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The layout of a mounted ConfigMap, with the files linked to a hidden
+	// data directory.
+	data := path.Join(dir, "..data")
+	require.NoError(t, os.MkdirAll(path.Join(data, "tls"), 0755))
+	for name, content := range map[string]string{
+		"host":         "example.com\n",
+		"server__port": "8080",
+		"hosts":        "a,b",
+		"unknown":      "ignored",
+		"tls/cert":     "cert.pem",
+	} {
+		require.NoError(t, ioutil.WriteFile(
+			path.Join(data, name), []byte(content), 0644))
+	}
+	for _, name := range []string{"host", "server__port", "hosts", "unknown", "tls"} {
+		require.NoError(t, os.Symlink(path.Join("..data", name), path.Join(dir, name)))
+	}
+
+	type Config struct {
+		Host   string
+		Hosts  []string
+		Server struct {
+			Port int
+			Name string
+		}
+		TLS struct {
+			Cert string
+		}
+	}
+
+	setOS(nil, map[string]string{"SERVER_NAME": "srv"})
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true, DirSource: dir}))
+	assert.Equal(t, "example.com", config.Host)
+	assert.Equal(t, []string{"a", "b"}, config.Hosts)
+	assert.Equal(t, 8080, config.Server.Port)
+	assert.Equal(t, "srv", config.Server.Name)
+	assert.Equal(t, "cert.pem", config.TLS.Cert)
+
+	// Environment variables take precedence.
+	setOS(nil, map[string]string{"HOST": "fromenv"})
+	config = &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true, DirSource: dir}))
+	assert.Equal(t, "fromenv", config.Host)
+
+	// A missing directory is ignored.
+	require.NoError(t, Load(&Config{}, Conf{
+		FileDisable: true,
+		DirSource:   path.Join(dir, "missing"),
+	}))
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "server__port"), []byte("x"), 0644))
+	err = Load(&Config{}, Conf{FileDisable: true, DirSource: dir})
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, SourceDir, parseErr.Source)
+}
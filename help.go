@@ -0,0 +1,254 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !gonfig_noflags
+// +build !gonfig_noflags
+
+package gonfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/pflag"
+)
+
+// helpFormatJSON is the value of the help flag that prints the help as JSON.
+const helpFormatJSON = "json"
+
+// helpValue is the value of the help flag.  It behaves like a boolean flag,
+// but also accepts --help=json to print the help in JSON.
+type helpValue string
+
+func (v *helpValue) String() string {
+	return string(*v)
+}
+
+func (v *helpValue) Set(s string) error {
+	if s == helpFormatJSON {
+		*v = helpValue(s)
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid help format: %s", s)
+	}
+	*v = helpValue(strconv.FormatBool(b))
+	return nil
+}
+
+// Type returns "bool", so that pflag shows the flag as a boolean flag.
+func (v *helpValue) Type() string {
+	return "bool"
+}
+
+// defaultHelpTemplate is the template used when no Conf.HelpTemplate is set.
+const defaultHelpTemplate = `{{.Message}}
+{{.Usages}}
+{{range .Groups}}{{.Name}}:
+{{.Usages}}
+{{end}}`
+
+// HelpData is the data passed to the help template.
+type HelpData struct {
+	// Message is the help message, like "Usage of myapp:".
+	Message string
+	// Flags are the flags that are not in a group.
+	Flags []HelpFlag
+	// Usages are the formatted usages of the flags that are not in a group.
+	Usages string
+	// Groups are the groups of flags, in the order of the struct.
+	Groups []HelpGroup
+}
+
+// HelpGroup is a group of flags in the help message.
+type HelpGroup struct {
+	// Name is the name of the group, as given in the group tag.
+	Name string
+	// Flags are the flags in the group.
+	Flags []HelpFlag
+	// Usages are the formatted usages of the flags in the group.
+	Usages string
+}
+
+// HelpFlag describes a flag in the help message.
+type HelpFlag struct {
+	// Name is the name of the flag, without the leading dashes.
+	Name string
+	// Shorthand is the one letter shorthand of the flag, if any.
+	Shorthand string
+	// Usage is the description of the flag.
+	Usage string
+	// Default is the default value of the flag.
+	Default string
+	// Env is the environment variable of the config variable, if any.
+	Env string
+}
+
+// helpMessage returns the help message printed before the flags.
+func helpMessage(s *setup) string {
+	if s.conf.HelpMessage != "" {
+		return s.conf.HelpMessage
+	}
+
+	exec := path.Base(os.Args[0])
+	return strings.Replace(defaultHelpMessage, "__EXEC__", exec, 1)
+}
+
+// helpData builds the data for the help template from the flag set.
+func helpData(s *setup) HelpData {
+	byID := optionsByID(s.allOpts)
+
+	newFlagSet := func() *pflag.FlagSet {
+		flagSet := pflag.NewFlagSet("", pflag.ContinueOnError)
+		flagSet.SortFlags = s.conf.HelpSortFlags
+		return flagSet
+	}
+
+	data := HelpData{Message: helpMessage(s)}
+	ungrouped := newFlagSet()
+	var groupSets []*pflag.FlagSet
+	groupIdx := make(map[string]int)
+
+	s.flagSet.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+
+		flag := HelpFlag{
+			Name:      f.Name,
+			Shorthand: f.Shorthand,
+			Usage:     f.Usage,
+			Default:   f.DefValue,
+		}
+
+		opt, ok := byID[f.Name]
+		if ok && !s.conf.EnvDisable {
+			flag.Env = envKey(s.conf.EnvPrefix, opt.fullIDParts)
+		}
+		if !ok || opt.group == "" {
+			data.Flags = append(data.Flags, flag)
+			ungrouped.AddFlag(f)
+			return
+		}
+
+		i, ok := groupIdx[opt.group]
+		if !ok {
+			i = len(data.Groups)
+			groupIdx[opt.group] = i
+			data.Groups = append(data.Groups, HelpGroup{Name: opt.group})
+			groupSets = append(groupSets, newFlagSet())
+		}
+		data.Groups[i].Flags = append(data.Groups[i].Flags, flag)
+		groupSets[i].AddFlag(f)
+	})
+
+	data.Usages = ungrouped.FlagUsages()
+	sortHelpFlags(s, data.Flags)
+	for i := range data.Groups {
+		data.Groups[i].Usages = groupSets[i].FlagUsages()
+		sortHelpFlags(s, data.Groups[i].Flags)
+	}
+	return data
+}
+
+// sortHelpFlags sorts the flags by name if requested in the Conf.
+func sortHelpFlags(s *setup, flags []HelpFlag) {
+	if s.conf.HelpSortFlags {
+		sort.Slice(flags, func(i, j int) bool {
+			return flags[i].Name < flags[j].Name
+		})
+	}
+}
+
+// writeHelp writes the help message to w using the help template.
+func writeHelp(s *setup, w io.Writer) error {
+	text := s.conf.HelpTemplate
+	if text == "" {
+		text = defaultHelpTemplate
+	}
+
+	tmpl, err := template.New("help").Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, helpData(s))
+}
+
+// helpJSONOption describes a config variable in the JSON help.
+type helpJSONOption struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Flag        string   `json:"flag,omitempty"`
+	Shorthand   string   `json:"shorthand,omitempty"`
+	Env         string   `json:"env,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	OneOf       []string `json:"oneof,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Secret      bool     `json:"secret,omitempty"`
+	Deprecated  string   `json:"deprecated,omitempty"`
+}
+
+// helpJSONOptions returns the JSON descriptions of the options and their
+// sub-options, in the order of the struct.
+func helpJSONOptions(s *setup, opts []*option) []helpJSONOption {
+	var result []helpJSONOption
+	for _, opt := range opts {
+		if opt.isParent {
+			result = append(result, helpJSONOptions(s, opt.subOpts)...)
+			continue
+		}
+
+		descOpt := *opt
+		if opt.secret {
+			// Don't leak secret default values in the description.
+			descOpt.defaul = ""
+		}
+		o := helpJSONOption{
+			ID:          opt.fullID(),
+			Type:        opt.value.Type().String(),
+			Description: expandDesc(s, &descOpt),
+			Group:       opt.group,
+			OneOf:       opt.oneof,
+			Required:    opt.required,
+			Secret:      opt.secret,
+			Deprecated:  opt.deprecated,
+		}
+		if !opt.secret {
+			o.Default = opt.defaul
+		}
+		if f := s.flagSet.Lookup(opt.fullID()); f != nil && opt.allowsSource(SourceFlag) {
+			o.Flag = f.Name
+			o.Shorthand = f.Shorthand
+		}
+		if !s.conf.EnvDisable && opt.allowsSource(SourceEnv) {
+			o.Env = envKey(s.conf.EnvPrefix, opt.fullIDParts)
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+// writeHelpJSON writes the description of all config variables as JSON to w.
+func writeHelpJSON(s *setup, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Usage   string           `json:"usage"`
+		Options []helpJSONOption `json:"options"`
+	}{
+		Usage:   helpMessage(s),
+		Options: helpJSONOptions(s, s.opts),
+	})
+}
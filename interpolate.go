@@ -0,0 +1,144 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// referencePattern matches the references to other config variables in
+// values, like ${data_dir}, and the escaped $${ that stands for a literal ${.
+var referencePattern = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+// interpolate replaces the references to other config variables in the values
+// of all string options, and slices of strings, with the values of those
+// config variables, for Conf.Interpolate.
+func interpolate(s *setup) error {
+	if !s.conf.Interpolate {
+		return nil
+	}
+
+	byID := optionsByID(s.allOpts)
+	done := make(map[*option]bool)
+	for _, opt := range s.allOpts {
+		if err := interpolateOption(byID, opt, done, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// interpolateOption interpolates the value of the option, after interpolating
+// the options it refers to.  The stack holds the options that are being
+// interpolated, to detect cycles.
+func interpolateOption(byID map[string]*option, opt *option, done map[*option]bool, stack []*option) error {
+	if done[opt] {
+		return nil
+	}
+	for i, o := range stack {
+		if o == opt {
+			var chain []string
+			for _, o := range stack[i:] {
+				chain = append(chain, o.fullID())
+			}
+			return fmt.Errorf("interpolation cycle detected: %s -> %s",
+				strings.Join(chain, " -> "), opt.fullID())
+		}
+	}
+	stack = append(stack, opt)
+
+	v := opt.value
+	if opt.isPointer {
+		if v.IsNil() {
+			done[opt] = true
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	var values []reflect.Value
+	switch {
+	case opt.isParent || opt.elemType != nil:
+	case opt.isSlice && v.Type().Elem().Kind() == reflect.String:
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i))
+		}
+	case v.Kind() == reflect.String:
+		values = append(values, v)
+	}
+
+	changed := false
+	for _, value := range values {
+		str := value.String()
+		if !strings.Contains(str, "${") {
+			continue
+		}
+
+		var err error
+		result := referencePattern.ReplaceAllStringFunc(str, func(ref string) string {
+			if ref == "$${" {
+				return "${"
+			}
+			if err != nil {
+				return ""
+			}
+			var val string
+			val, err = referenceValue(byID, opt, ref[2:len(ref)-1], done, stack)
+			return val
+		})
+		if err != nil {
+			return err
+		}
+
+		value.SetString(result)
+		changed = true
+	}
+	done[opt] = true
+
+	if changed {
+		normalize(opt)
+		if err := validate(opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referenceValue returns the value of the config variable with the given ID
+// that is referred to in the value of the option.
+func referenceValue(byID map[string]*option, opt *option, id string, done map[*option]bool, stack []*option) (string, error) {
+	target, ok := lookupRelative(byID, opt, id)
+	if !ok {
+		return "", fmt.Errorf("unknown config variable %s referred to by %s",
+			id, opt.fullID())
+	}
+	if target.isParent || target.isSlice {
+		return "", fmt.Errorf("config variable %s referred to by %s must "+
+			"have a simple value", target.fullID(), opt.fullID())
+	}
+	if target.secret && !opt.secret {
+		return "", fmt.Errorf("secret config variable %s can only be "+
+			"referred to by secret config variables, not by %s",
+			target.fullID(), opt.fullID())
+	}
+
+	if err := interpolateOption(byID, target, done, stack); err != nil {
+		return "", err
+	}
+
+	v := target.value
+	if target.isPointer {
+		if v.IsNil() {
+			return "", fmt.Errorf("config variable %s referred to by %s is "+
+				"not set", target.fullID(), opt.fullID())
+		}
+		v = v.Elem()
+	}
+	return formatSimpleValue(v)
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package gonfig
+
+// LoadT loads the configuration into a new config struct of type T and
+// returns it.  It behaves like Load, but the type of the config struct is
+// checked at compile time:
+//
+//	config, err := gonfig.LoadT[Config](gonfig.Conf{EnvPrefix: "MYAPP_"})
+//
+// The config struct is nil when an error is returned.
+func LoadT[T any](conf Conf) (*T, error) {
+	c := new(T)
+	if err := Load(c, conf); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadT(t *testing.T) {
+	requireFlags(t)
+
+	type Config struct {
+		Port int    `default:"80"`
+		Host string `default:"localhost"`
+	}
+
+	setOS([]string{"--port", "8080"}, nil)
+	config, err := LoadT[Config](Conf{FileDisable: true})
+	require.NoError(t, err)
+	assert.Equal(t, &Config{Port: 8080, Host: "localhost"}, config)
+
+	setOS([]string{"--port", "x"}, nil)
+	config, err = LoadT[Config](Conf{FileDisable: true})
+	assert.Error(t, err)
+	assert.Nil(t, config)
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The supported cloud metadata providers.
+const (
+	CloudAWS   = "aws"
+	CloudGCP   = "gcp"
+	CloudAzure = "azure"
+)
+
+// metadataTimeout is the timeout for every request to the metadata service.
+const metadataTimeout = 2 * time.Second
+
+// metadataKeys holds the provider-independent metadata keys that can be used
+// in the metadata tag.
+var metadataKeys = []string{"instance-id", "region", "zone", "hostname"}
+
+// metadataProvider describes how to query the metadata service of a cloud
+// provider.
+type metadataProvider struct {
+	endpoint string            // the default base URL
+	headers  map[string]string // the headers to send with every request
+	paths    map[string]string // the paths for the metadata keys
+	userData string            // the path for the user data
+
+	// transform optionally converts a value for a metadata key.
+	transform func(key, value string) string
+	// decodeUserData optionally decodes the user data.
+	decodeUserData func(data []byte) ([]byte, error)
+}
+
+var metadataProviders = map[string]*metadataProvider{
+	CloudAWS: {
+		endpoint: "http://169.254.169.254",
+		paths: map[string]string{
+			"instance-id": "/latest/meta-data/instance-id",
+			"region":      "/latest/meta-data/placement/region",
+			"zone":        "/latest/meta-data/placement/availability-zone",
+			"hostname":    "/latest/meta-data/hostname",
+		},
+		userData: "/latest/user-data",
+	},
+	CloudGCP: {
+		endpoint: "http://metadata.google.internal",
+		headers:  map[string]string{"Metadata-Flavor": "Google"},
+		paths: map[string]string{
+			"instance-id": "/computeMetadata/v1/instance/id",
+			"region":      "/computeMetadata/v1/instance/zone",
+			"zone":        "/computeMetadata/v1/instance/zone",
+			"hostname":    "/computeMetadata/v1/instance/hostname",
+		},
+		userData: "/computeMetadata/v1/instance/attributes/user-data",
+		transform: func(key, value string) string {
+			// Zones are given as projects/<number>/zones/<zone>.
+			if key == "zone" || key == "region" {
+				value = value[strings.LastIndex(value, "/")+1:]
+			}
+			// Regions are zones without the last part, like us-central1.
+			if key == "region" && strings.LastIndex(value, "-") > 0 {
+				value = value[:strings.LastIndex(value, "-")]
+			}
+			return value
+		},
+	},
+	CloudAzure: {
+		endpoint: "http://169.254.169.254",
+		headers:  map[string]string{"Metadata": "true"},
+		paths: map[string]string{
+			"instance-id": "/metadata/instance/compute/vmId?api-version=2021-02-01&format=text",
+			"region":      "/metadata/instance/compute/location?api-version=2021-02-01&format=text",
+			"zone":        "/metadata/instance/compute/zone?api-version=2021-02-01&format=text",
+			"hostname":    "/metadata/instance/compute/name?api-version=2021-02-01&format=text",
+		},
+		userData: "/metadata/instance/compute/userData?api-version=2021-01-01&format=text",
+		decodeUserData: func(data []byte) ([]byte, error) {
+			return base64.StdEncoding.DecodeString(string(data))
+		},
+	},
+}
+
+// metadataClient performs requests to a cloud metadata service.
+type metadataClient struct {
+	ctx      context.Context
+	provider *metadataProvider
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// newMetadataClient creates a client for the metadata service of the provider
+// configured in the Conf.  For AWS, this requests an IMDSv2 session token.
+func newMetadataClient(s *setup) (*metadataClient, error) {
+	provider, ok := metadataProviders[s.conf.CloudMetadata]
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud metadata provider: %s",
+			s.conf.CloudMetadata)
+	}
+
+	m := &metadataClient{
+		ctx:      s.ctx,
+		provider: provider,
+		endpoint: strings.TrimSuffix(s.conf.CloudMetadataEndpoint, "/"),
+		headers:  make(map[string]string),
+		client:   &http.Client{Timeout: metadataTimeout},
+	}
+	if m.endpoint == "" {
+		m.endpoint = provider.endpoint
+	}
+	for k, v := range provider.headers {
+		m.headers[k] = v
+	}
+
+	if s.conf.CloudMetadata == CloudAWS {
+		token, _, err := m.request("PUT", "/latest/api/token", map[string]string{
+			"X-aws-ec2-metadata-token-ttl-seconds": "60",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get IMDSv2 token: %s", err)
+		}
+		m.headers["X-aws-ec2-metadata-token"] = string(token)
+	}
+
+	return m, nil
+}
+
+// request performs a request to the metadata service.  The second return
+// value is false if the value was not found.
+func (m *metadataClient) request(method, path string, headers map[string]string) ([]byte, bool, error) {
+	req, err := http.NewRequest(method, m.endpoint+path, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req = req.WithContext(m.ctx)
+	for k, v := range m.headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("unexpected status from %s: %s",
+			path, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return body, true, nil
+}
+
+// lookup returns the value for the metadata key.
+func (m *metadataClient) lookup(key string) (string, bool, error) {
+	body, found, err := m.request("GET", m.provider.paths[key], nil)
+	if err != nil || !found {
+		return "", false, err
+	}
+
+	value := strings.TrimSpace(string(body))
+	if m.provider.transform != nil {
+		value = m.provider.transform(key, value)
+	}
+	return value, true, nil
+}
+
+// fetchUserData returns the user data of the instance.
+func (m *metadataClient) fetchUserData() ([]byte, bool, error) {
+	data, found, err := m.request("GET", m.provider.userData, nil)
+	if err != nil || !found || len(data) == 0 {
+		return nil, false, err
+	}
+
+	if m.provider.decodeUserData != nil {
+		if data, err = m.provider.decodeUserData(data); err != nil {
+			return nil, false, fmt.Errorf("failed to decode user data: %s", err)
+		}
+	}
+	return data, true, nil
+}
+
+// checkMetadataKeys checks that all options use known metadata keys.
+func checkMetadataKeys(allOpts []*option) error {
+	for _, opt := range allOpts {
+		if opt.metadata == "" {
+			continue
+		}
+
+		known := false
+		for _, key := range metadataKeys {
+			if opt.metadata == key {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown metadata key for %s: %s (must be one "+
+				"of [%s])", opt.fullID(), opt.metadata,
+				strings.Join(metadataKeys, ", "))
+		}
+	}
+
+	return nil
+}
+
+// parseMetadata reads the values for the options with a metadata tag from the
+// cloud metadata service and writes them in place.  Then, if
+// Conf.CloudMetadataUserData is set and the instance has user data, it is
+// decoded like a config file and the values in it are written in place as
+// well.
+func parseMetadata(s *setup) error {
+	m, err := newMetadataClient(s)
+	if err != nil {
+		return err
+	}
+
+	for _, opt := range s.allOpts {
+		if opt.metadata == "" {
+			continue
+		}
+
+		value, found, err := m.lookup(opt.metadata)
+		if err != nil {
+			return fmt.Errorf("failed to fetch metadata %s for %s: %s",
+				opt.metadata, opt.fullID(), err)
+		}
+		if !found {
+			continue
+		}
+
+		before := opt.value.Interface()
+		if err := opt.setValueByString(value); err != nil {
+			return newParseError(opt, SourceMetadata, value, err)
+		}
+		if err := sourceSet(s, opt, SourceMetadata, before); err != nil {
+			return err
+		}
+	}
+
+	if !s.conf.CloudMetadataUserData {
+		return nil
+	}
+
+	data, found, err := m.fetchUserData()
+	if err != nil {
+		return fmt.Errorf("failed to fetch user data: %s", err)
+	}
+	if !found {
+		return nil
+	}
+
+	decoder := s.conf.FileDecoder
+	if decoder == nil {
+		decoder = DecoderTryAll
+	}
+	values, err := decoder(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse user data: %w", err)
+	}
+	mergeBlocks(s, values, s.opts)
+
+	return parseMapOpts(s, values, s.opts, SourceMetadata)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type metadataTestStruct struct {
+	InstanceID string `id:"instance-id" metadata:"instance-id"`
+	Region     string `metadata:"region"`
+	Zone       string `metadata:"zone"`
+	Port       int
+}
+
+func TestLoad_CloudMetadataAWS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			require.Equal(t, "PUT", r.Method)
+			w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1234"))
+		case "/latest/meta-data/placement/region":
+			w.Write([]byte("eu-west-1"))
+		case "/latest/user-data":
+			w.Write([]byte(`{"port": 8080}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	setOS(nil, nil)
+	config := &metadataTestStruct{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable:           true,
+		CloudMetadata:         CloudAWS,
+		CloudMetadataEndpoint: server.URL,
+	}))
+
+	assert.Equal(t, "i-1234", config.InstanceID)
+	assert.Equal(t, "eu-west-1", config.Region)
+	assert.Equal(t, "", config.Zone)
+	assert.Equal(t, 0, config.Port)
+
+	config = &metadataTestStruct{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable:           true,
+		CloudMetadata:         CloudAWS,
+		CloudMetadataEndpoint: server.URL,
+		CloudMetadataUserData: true,
+	}))
+	assert.Equal(t, 8080, config.Port)
+}
+
+func TestLoad_CloudMetadataGCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("1234"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/42/zones/us-central1-a"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	setOS(nil, nil)
+	config := &metadataTestStruct{}
+	require.NoError(t, Load(config, Conf{
+		FileDisable:           true,
+		CloudMetadata:         CloudGCP,
+		CloudMetadataEndpoint: server.URL,
+	}))
+
+	assert.Equal(t, "1234", config.InstanceID)
+	assert.Equal(t, "us-central1", config.Region)
+	assert.Equal(t, "us-central1-a", config.Zone)
+}
+
+func TestLoad_CloudMetadataUnknownKey(t *testing.T) {
+	assert.Panics(t, func() {
+		Load(&struct {
+			V string `metadata:"color"`
+		}{}, Conf{FileDisable: true, EnvDisable: true, FlagDisable: true})
+	})
+}
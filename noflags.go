@@ -0,0 +1,51 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build gonfig_noflags
+// +build gonfig_noflags
+
+package gonfig
+
+import (
+	"errors"
+	"io"
+)
+
+// This file replaces the command line flag support when building with the
+// gonfig_noflags build tag.  Command line flags are then never parsed.
+
+// FlagSet is an empty placeholder for the flag set type without flag support.
+type FlagSet struct{}
+
+// ErrorHandling is a placeholder for the type of Conf.FlagErrorHandling
+// without flag support.
+type ErrorHandling int
+
+// flagState is empty as there is no command line flag state.
+type flagState struct{}
+
+// parseFlags does nothing without flag support.
+func parseFlags(s *setup) error {
+	return nil
+}
+
+// lookupConfigFileFlag never finds a config file without flag support.
+func lookupConfigFileFlag(s *setup, configOpt *option) (string, error) {
+	return "", nil
+}
+
+// lookupEnvFilesFlag never finds env files without flag support.
+func lookupEnvFilesFlag(s *setup) ([]string, error) {
+	return nil, nil
+}
+
+// GenerateCompletion is not supported without flag support.
+func GenerateCompletion(c interface{}, conf Conf, shell string, w io.Writer) error {
+	return errors.New("gonfig built without support for command line flags")
+}
+
+// RegisterFlags does nothing and returns nil without flag support.
+func RegisterFlags(c interface{}, conf Conf) *FlagSet {
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build gonfig_noflags
+// +build gonfig_noflags
+
+package gonfig
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireFlags skips tests that pass command line flags, as they are not
+// parsed with the gonfig_noflags build tag.
+func requireFlags(t *testing.T) {
+	t.Skip("command line flags are not supported with gonfig_noflags")
+}
+
+func TestLoad_NoFlags(t *testing.T) {
+	type Config struct {
+		Port int `default:"80"`
+		Host string
+	}
+
+	// Command line flags are ignored, also unknown ones.
+	setOS([]string{"--port", "8080", "--unknown"}, map[string]string{"HOST": "localhost"})
+	config := &Config{}
+	require.NoError(t, Load(config, Conf{FileDisable: true}))
+	assert.Equal(t, 80, config.Port)
+	assert.Equal(t, "localhost", config.Host)
+
+	assert.Nil(t, RegisterFlags(config, Conf{}))
+	assert.Error(t, GenerateCompletion(config, Conf{}, "bash", &bytes.Buffer{}))
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// The normalizers supported by the normalize tag.
+const (
+	normalizeTrim   = "trim"
+	normalizeLower  = "lower"
+	normalizeUpper  = "upper"
+	normalizeDedupe = "dedupe"
+)
+
+// checkNormalizers checks that the normalizers of all options are known and
+// that they can be applied to the type of the option.
+func checkNormalizers(allOpts []*option) error {
+	for _, opt := range allOpts {
+		for _, n := range opt.normalize {
+			t := opt.value.Type()
+			if opt.isPointer {
+				t = t.Elem()
+			}
+			switch n {
+			case normalizeTrim, normalizeLower, normalizeUpper:
+				if opt.isSlice {
+					t = t.Elem()
+				}
+				if t.Kind() != reflect.String {
+					return fmt.Errorf("normalizer %s for %s requires a string "+
+						"or a slice of strings", n, opt.fullID())
+				}
+
+			case normalizeDedupe:
+				if !opt.isSlice {
+					return fmt.Errorf("normalizer %s for %s requires a slice",
+						n, opt.fullID())
+				}
+
+			default:
+				return fmt.Errorf("unknown normalizer for %s: %s", opt.fullID(), n)
+			}
+		}
+	}
+
+	return nil
+}
+
+// normalizeString applies the string normalizers of the option to v.
+func normalizeString(opt *option, v reflect.Value) {
+	str := v.String()
+	for _, n := range opt.normalize {
+		switch n {
+		case normalizeTrim:
+			str = strings.TrimSpace(str)
+		case normalizeLower:
+			str = strings.ToLower(str)
+		case normalizeUpper:
+			str = strings.ToUpper(str)
+		}
+	}
+	v.SetString(str)
+}
+
+// dedupe removes the duplicate elements from the slice value v, keeping the
+// first occurrence of every element.
+func dedupe(v reflect.Value) {
+	unique := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		duplicate := false
+		for j := 0; j < unique.Len(); j++ {
+			if reflect.DeepEqual(elem.Interface(), unique.Index(j).Interface()) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = reflect.Append(unique, elem)
+		}
+	}
+	v.Set(unique)
+}
+
+// normalize applies the normalizers of the option to its value.  For slices,
+// the string normalizers are applied to every element before deduplicating.
+func normalize(opt *option) {
+	if len(opt.normalize) == 0 {
+		return
+	}
+
+	if opt.isPointer {
+		if !opt.value.IsNil() {
+			p := opt.pointee()
+			p.value = opt.value.Elem()
+			normalize(p)
+		}
+		return
+	}
+
+	if !opt.isSlice {
+		normalizeString(opt, opt.value)
+		return
+	}
+
+	if opt.value.Type().Elem().Kind() == reflect.String {
+		for i := 0; i < opt.value.Len(); i++ {
+			normalizeString(opt, opt.value.Index(i))
+		}
+	}
+
+	for _, n := range opt.normalize {
+		if n == normalizeDedupe {
+			dedupe(opt.value)
+		}
+	}
+}
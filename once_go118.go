@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package gonfig
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Loader loads a config struct of type T exactly once, on first use, which
+// makes it suited for a lazily initialized global configuration:
+//
+//	var config = gonfig.NewLoader[Config](gonfig.Conf{})
+//
+//	func main() {
+//		config.MustLoad()
+//		...
+//	}
+//
+//	func handler() {
+//		port := config.Get().Port
+//		...
+//	}
+//
+// All methods are safe for concurrent use.  When loading fails, the error is
+// kept and loading is not retried.  Panics from Load, like for problems with
+// the config struct, are turned into errors.
+type Loader[T any] struct {
+	conf   Conf
+	once   sync.Once
+	config *T
+	err    error
+}
+
+// NewLoader creates a new Loader that loads a config struct of type T with
+// the given Conf.
+func NewLoader[T any](conf Conf) *Loader[T] {
+	return &Loader[T]{conf: conf}
+}
+
+// Load loads the configuration on its first call and returns the result of
+// that load on all calls.
+func (l *Loader[T]) Load() (*T, error) {
+	l.once.Do(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				l.err = fmt.Errorf("panic while loading config: %v", r)
+			}
+		}()
+
+		l.config, l.err = LoadT[T](l.conf)
+	})
+	return l.config, l.err
+}
+
+// MustLoad is like Load, but panics when loading fails.
+func (l *Loader[T]) MustLoad() *T {
+	config, err := l.Load()
+	if err != nil {
+		panic(err)
+	}
+	return config
+}
+
+// Get returns the configuration, loading it if that did not happen yet.  It
+// panics when loading fails, like MustLoad.
+func (l *Loader[T]) Get() *T {
+	return l.MustLoad()
+}
+
+// Once returns a function that loads the configuration into a new config
+// struct of type T on its first call, and returns the result of that load on
+// all later calls.  It is a shorthand for the Load method of a Loader.
+func Once[T any](conf Conf) func() (*T, error) {
+	return NewLoader[T](conf).Load
+}
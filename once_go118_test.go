@@ -0,0 +1,105 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package gonfig
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnce(t *testing.T) {
+	type Config struct {
+		Port int `default:"80"`
+	}
+
+	setOS(nil, map[string]string{"PORT": "8080"})
+	config := Once[Config](Conf{FileDisable: true})
+
+	var wg sync.WaitGroup
+	results := make([]*Config, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := config()
+			assert.NoError(t, err)
+			results[i] = c
+		}(i)
+	}
+	wg.Wait()
+
+	require.NotNil(t, results[0])
+	assert.Equal(t, 8080, results[0].Port)
+	for _, c := range results {
+		assert.Same(t, results[0], c)
+	}
+
+	// The values are not reloaded.
+	setOS(nil, map[string]string{"PORT": "9090"})
+	c, err := config()
+	require.NoError(t, err)
+	assert.Equal(t, 8080, c.Port)
+}
+
+func TestOnce_Error(t *testing.T) {
+	type Config struct {
+		Port int
+	}
+
+	setOS(nil, map[string]string{"PORT": "x"})
+	config := Once[Config](Conf{FileDisable: true})
+	c, err := config()
+	assert.Nil(t, c)
+	require.Error(t, err)
+
+	// The error is memoized.
+	setOS(nil, map[string]string{"PORT": "80"})
+	c, err2 := config()
+	assert.Nil(t, c)
+	assert.Equal(t, err, err2)
+}
+
+func TestLoader(t *testing.T) {
+	type Config struct {
+		Port int `default:"80"`
+	}
+
+	setOS(nil, map[string]string{"PORT": "8080"})
+	loader := NewLoader[Config](Conf{FileDisable: true})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, 8080, loader.Get().Port)
+		}()
+	}
+	wg.Wait()
+
+	assert.Same(t, loader.MustLoad(), loader.Get())
+}
+
+func TestLoader_Panic(t *testing.T) {
+	type Config struct {
+		Port int `default:"x"`
+	}
+
+	setOS(nil, nil)
+	loader := NewLoader[Config](Conf{FileDisable: true})
+	c, err := loader.Load()
+	assert.Nil(t, c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "panic while loading config")
+
+	assert.Panics(t, func() { loader.MustLoad() })
+	assert.Panics(t, func() { loader.Get() })
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+)
+
+// registryKeyPath returns the path of the registry key under
+// HKEY_LOCAL_MACHINE that holds the parameters of the Windows service.
+func registryKeyPath(service string) string {
+	return `SYSTEM\CurrentControlSet\Services\` + service + `\Parameters`
+}
+
+// parseRegistry parses the registry values of the Windows service parameters
+// for all config options and writes the values that have been found in place.
+func parseRegistry(s *setup) error {
+	var names []string
+	for _, opt := range s.allOpts {
+		if !opt.isParent {
+			names = append(names, opt.fullID())
+		}
+	}
+
+	path := registryKeyPath(s.conf.WindowsService)
+	values, err := readRegistryValues(path, names)
+	if err != nil {
+		return fmt.Errorf("failed to read parameters of Windows service %s: %s",
+			s.conf.WindowsService, err)
+	}
+
+	for _, opt := range s.allOpts {
+		if opt.isParent {
+			continue
+		}
+
+		value, set := values[opt.fullID()]
+		if !set {
+			continue
+		}
+
+		value, err := resolveSecret(s, opt, value)
+		if err != nil {
+			return err
+		}
+
+		before := opt.value.Interface()
+		if err := opt.setValueByString(value); err != nil {
+			return newParseError(opt, SourceRegistry, value, err)
+		}
+		if err := sourceSet(s, opt, SourceRegistry, before); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
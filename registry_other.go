@@ -0,0 +1,17 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package gonfig
+
+import (
+	"errors"
+)
+
+// readRegistryValues is not supported on platforms other than Windows.
+func readRegistryValues(path string, names []string) (map[string]string, error) {
+	return nil, errors.New("the registry is only available on Windows")
+}
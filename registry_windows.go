@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package gonfig
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// utf16BytesToString converts the little-endian UTF-16 encoded bytes of a
+// registry string value to a string, stopping at the first NUL character.
+func utf16BytesToString(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return syscall.UTF16ToString(u)
+}
+
+// expandEnvironmentStrings expands the %VAR% references in a REG_EXPAND_SZ
+// value.  References to undefined variables are left untouched, like Windows
+// does.
+func expandEnvironmentStrings(str string) string {
+	var buf bytes.Buffer
+	for {
+		start := strings.IndexByte(str, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(str[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+
+		buf.WriteString(str[:start])
+		if val, ok := os.LookupEnv(str[start+1 : end]); ok && end > start+1 {
+			buf.WriteString(val)
+			str = str[end+1:]
+		} else {
+			// Keep the first percent sign and continue from the second one.
+			buf.WriteString(str[start:end])
+			str = str[end:]
+		}
+	}
+	buf.WriteString(str)
+	return buf.String()
+}
+
+// multiStringToCSV converts the content of a REG_MULTI_SZ value to a comma
+// separated list, so that it can be parsed as a slice.
+func multiStringToCSV(b []byte) (string, error) {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+
+	var items []string
+	for start, i := 0, 0; i < len(u); i++ {
+		if u[i] == 0 {
+			if i == start {
+				// An empty string terminates the list.
+				break
+			}
+			items = append(items, syscall.UTF16ToString(u[start:i]))
+			start = i + 1
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(items); err != nil {
+		return "", err
+	}
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n"), w.Error()
+}
+
+// readRegistryValue reads the value with the given name from the registry key
+// and converts it to a string.  The second return value is false if the value
+// does not exist.
+func readRegistryValue(key syscall.Handle, name string) (string, bool, error) {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return "", false, err
+	}
+
+	var typ, size uint32
+	err = syscall.RegQueryValueEx(key, namePtr, nil, &typ, nil, &size)
+	if err == syscall.ERROR_FILE_NOT_FOUND {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+
+	buf := make([]byte, size+2)
+	err = syscall.RegQueryValueEx(key, namePtr, nil, &typ, &buf[0], &size)
+	if err != nil {
+		return "", false, err
+	}
+	str, err := registryValueString(name, typ, buf[:size])
+	if err != nil {
+		return "", false, err
+	}
+	return str, true, nil
+}
+
+// registryValueString converts the content of the registry value with the
+// given name and type to a string.
+func registryValueString(name string, typ uint32, buf []byte) (string, error) {
+	switch typ {
+	case syscall.REG_SZ:
+		return utf16BytesToString(buf), nil
+
+	case syscall.REG_EXPAND_SZ:
+		return expandEnvironmentStrings(utf16BytesToString(buf)), nil
+
+	case syscall.REG_MULTI_SZ:
+		return multiStringToCSV(buf)
+
+	case syscall.REG_DWORD:
+		if len(buf) < 4 {
+			return "", fmt.Errorf("invalid DWORD value for %s", name)
+		}
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(buf)), 10), nil
+
+	case syscall.REG_QWORD:
+		if len(buf) < 8 {
+			return "", fmt.Errorf("invalid QWORD value for %s", name)
+		}
+		return strconv.FormatUint(binary.LittleEndian.Uint64(buf), 10), nil
+
+	default:
+		return "", fmt.Errorf("unsupported type of registry value %s: %d",
+			name, typ)
+	}
+}
+
+// readRegistryValues reads the values with the given names from the registry
+// key at path under HKEY_LOCAL_MACHINE.  Values that do not exist are
+// omitted; if the key itself does not exist, no values are returned.
+func readRegistryValues(path string, names []string) (map[string]string, error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key syscall.Handle
+	err = syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, pathPtr, 0,
+		syscall.KEY_READ, &key)
+	if err == syscall.ERROR_FILE_NOT_FOUND {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer syscall.RegCloseKey(key)
+
+	values := make(map[string]string)
+	for _, name := range names {
+		value, ok, err := readRegistryValue(key, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
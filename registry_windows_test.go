@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package gonfig
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// utf16Bytes encodes the strings as little-endian UTF-16, each followed by a
+// NUL character, like registry string values.
+func utf16Bytes(strs ...string) []byte {
+	var b []byte
+	for _, str := range strs {
+		for _, u := range append(utf16.Encode([]rune(str)), 0) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+	}
+	return b
+}
+
+func TestUTF16BytesToString(t *testing.T) {
+	assert.Equal(t, "héllo", utf16BytesToString(utf16Bytes("héllo")))
+	assert.Equal(t, "first", utf16BytesToString(utf16Bytes("first", "second")))
+	assert.Equal(t, "", utf16BytesToString(nil))
+	// A trailing odd byte is ignored.
+	assert.Equal(t, "a", utf16BytesToString([]byte{'a', 0, 'b'}))
+}
+
+func TestExpandEnvironmentStrings(t *testing.T) {
+	os.Setenv("GONFIG_TEST_DIR", `C:\data`)
+	defer os.Unsetenv("GONFIG_TEST_DIR")
+	os.Unsetenv("GONFIG_TEST_UNDEFINED")
+
+	for str, expected := range map[string]string{
+		`%GONFIG_TEST_DIR%\app`:               `C:\data\app`,
+		`%GONFIG_TEST_UNDEFINED%\app`:         `%GONFIG_TEST_UNDEFINED%\app`,
+		`100%`:                                `100%`,
+		`%%GONFIG_TEST_DIR%`:                  `%C:\data`,
+		`50% of %GONFIG_TEST_DIR%`:            `50% of C:\data`,
+		`%GONFIG_TEST_DIR%;%GONFIG_TEST_DIR%`: `C:\data;C:\data`,
+	} {
+		assert.Equal(t, expected, expandEnvironmentStrings(str), str)
+	}
+}
+
+func TestMultiStringToCSV(t *testing.T) {
+	str, err := multiStringToCSV(utf16Bytes("one", "two, three", ""))
+	require.NoError(t, err)
+	assert.Equal(t, `one,"two, three"`, str)
+
+	// The items after an empty string are ignored.
+	str, err = multiStringToCSV(utf16Bytes("one", "", "two"))
+	require.NoError(t, err)
+	assert.Equal(t, "one", str)
+
+	str, err = multiStringToCSV(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", str)
+}
+
+func TestRegistryValueString(t *testing.T) {
+	os.Setenv("GONFIG_TEST_DIR", `C:\data`)
+	defer os.Unsetenv("GONFIG_TEST_DIR")
+
+	testCases := []struct {
+		typ      uint32
+		buf      []byte
+		expected string
+	}{
+		{syscall.REG_SZ, utf16Bytes("value"), "value"},
+		{syscall.REG_EXPAND_SZ, utf16Bytes(`%GONFIG_TEST_DIR%\app`), `C:\data\app`},
+		{syscall.REG_MULTI_SZ, utf16Bytes("a", "b", ""), "a,b"},
+		{syscall.REG_DWORD, []byte{0x01, 0x02, 0x00, 0x00}, "513"},
+		{syscall.REG_DWORD, []byte{0xFF, 0xFF, 0xFF, 0xFF}, "4294967295"},
+		{syscall.REG_QWORD, []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00},
+			"4294967296"},
+		{syscall.REG_QWORD, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+			"18446744073709551615"},
+	}
+	for _, tc := range testCases {
+		str, err := registryValueString("v", tc.typ, tc.buf)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, str)
+	}
+
+	_, err := registryValueString("v", syscall.REG_DWORD, []byte{1, 2})
+	assert.EqualError(t, err, "invalid DWORD value for v")
+	_, err = registryValueString("v", syscall.REG_QWORD, []byte{1, 2, 3, 4})
+	assert.EqualError(t, err, "invalid QWORD value for v")
+	_, err = registryValueString("v", syscall.REG_BINARY, []byte{1})
+	assert.EqualError(t, err, "unsupported type of registry value v: 3")
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// schemaDialect is the JSON Schema dialect of the schemas created by Schema.
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema (draft 2020-12) describing the config file for
+// the config struct at c, so that config files can be validated by editors
+// and other tools.  The schema contains the types, descriptions, defaults,
+// allowed values and ranges of the config variables, and lists the config
+// variables with the required tag that have no default value and can only be
+// set from the config file as required.  Config variables that can not be set
+// from the config file are left out, as are the defaults of secret config
+// variables.  The placeholders in the descriptions are expanded like in the
+// help message, with the names of the environment variables without prefix.
+// An error is returned if there is a problem with the configuration struct.
+func Schema(c interface{}) ([]byte, error) {
+	s := &setup{
+		conf: &Conf{},
+	}
+
+	if err := inspectConfigStructure(s, c); err != nil {
+		return nil, fmt.Errorf("error in config structure: %s", err)
+	}
+
+	schema := objectSchema(s, s.opts)
+	schema["$schema"] = schemaDialect
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// objectSchema returns the schema of an object with the options as properties.
+func objectSchema(s *setup, opts []*option) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for _, opt := range opts {
+		if !opt.allowsSource(SourceFile) || opt.sensitive {
+			continue
+		}
+
+		if opt.isParent {
+			schema := objectSchema(s, opt.subOpts)
+			if desc := schemaDesc(s, opt); desc != "" {
+				schema["description"] = desc
+			}
+			properties[opt.id] = schema
+			continue
+		}
+
+		properties[opt.id] = optionSchema(s, opt)
+		if requiredInFile(opt) {
+			required = append(required, opt.id)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// requiredInFile returns whether the option must be set in the config file:
+// it has the required tag, no default value and no other source can set it.
+func requiredInFile(opt *option) bool {
+	if !opt.required || opt.defaultSet || opt.fallback != "" {
+		return false
+	}
+	for _, source := range allSources {
+		if source != SourceFile && opt.allowsSource(source) {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaDesc returns the description of the option, with the placeholders
+// expanded like in the help message.
+func schemaDesc(s *setup, opt *option) string {
+	descOpt := *opt
+	if opt.secret {
+		// Don't leak secret default values in the description.
+		descOpt.defaul = ""
+	}
+	return expandDesc(s, &descOpt)
+}
+
+// optionSchema returns the schema of the value of the option.
+func optionSchema(s *setup, opt *option) map[string]interface{} {
+	t := opt.value.Type()
+	if opt.isPointer {
+		t = t.Elem()
+	}
+
+	var schema map[string]interface{}
+	switch {
+	case opt.elemType != nil:
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": objectSchema(s, opt.elemOpts),
+		}
+	case opt.isSlice:
+		schema = map[string]interface{}{
+			"type":  "array",
+			"items": valueSchema(opt, t.Elem()),
+		}
+	default:
+		schema = valueSchema(opt, t)
+	}
+
+	if desc := schemaDesc(s, opt); desc != "" {
+		schema["description"] = desc
+	}
+	if opt.defaultSet && !opt.secret {
+		schema["default"] = schemaValue(schema, t, opt.defaul)
+	}
+	if opt.deprecated != "" {
+		schema["deprecated"] = true
+	}
+	return schema
+}
+
+// valueSchema returns the schema of a single value of type t of the option,
+// including the restrictions of the oneof, min, max and pattern tags.
+func valueSchema(opt *option, t reflect.Type) map[string]interface{} {
+	schema := typeSchema(t)
+
+	if len(opt.oneof) > 0 {
+		enum := make([]interface{}, len(opt.oneof))
+		for i, value := range opt.oneof {
+			enum[i] = schemaValue(schema, t, value)
+		}
+		schema["enum"] = enum
+	}
+	if opt.min != nil {
+		schema["minimum"] = *opt.min
+	}
+	if opt.max != nil {
+		schema["maximum"] = *opt.max
+	}
+	if opt.pattern != nil {
+		schema["pattern"] = opt.pattern.String()
+	}
+	return schema
+}
+
+// typeSchema returns the schema of the type of a single value.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == typeOfByteSize, t == typeOfDuration:
+		// Sizes and durations are either human-readable strings or numbers of
+		// bytes and nanoseconds.
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	case t.Implements(typeOfTextUnmarshaler) ||
+		reflect.PtrTo(t).Implements(typeOfTextUnmarshaler):
+		return map[string]interface{}{"type": "string"}
+	case t == typeOfByteSlice:
+		return map[string]interface{}{
+			"type":            "string",
+			"contentEncoding": "base64",
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	}
+	return map[string]interface{}{}
+}
+
+// schemaValue returns the value of the string s, as given in a tag, as it
+// should appear in the schema.  Values of string types and durations are
+// returned as is, others are parsed into a value of type t.  When s can not be parsed, it is
+// returned as is.
+func schemaValue(schema map[string]interface{}, t reflect.Type, s string) interface{} {
+	if schema["type"] == "string" || t == typeOfDuration {
+		return s
+	}
+
+	v := reflect.New(t).Elem()
+	var err error
+	if t.Kind() == reflect.Slice && t != typeOfByteSlice {
+		err = parseSlice(v, s)
+	} else {
+		err = parseSimpleValue(v, s)
+	}
+	if err != nil {
+		return s
+	}
+	return v.Interface()
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchema(t *testing.T) {
+	type Config struct {
+		Host     string   `desc:"the host" required:"true"`
+		Name     string   `required:"true" sources:"file"`
+		Region   string   `required:"true" sources:"file" default:"eu"`
+		Port     int      `default:"80" min:"1" max:"65535" desc:"the port ({env}, default {default})"`
+		Level    string   `oneof:"debug,info"`
+		Ratio    float64  `default:"0.5"`
+		Tags     []string `default:"a,b" pattern:"^[a-z]+$"`
+		Limit    ByteSize `default:"1MiB"`
+		Verbose  *bool
+		Token    string `nofile:"true"`
+		Password string `secret:"true" default:"hunter2" desc:"the password (default {default})"`
+		Server   struct {
+			Timeout uint `default:"30"`
+		} `desc:"the server"`
+		Upstreams []struct {
+			Addr string `required:"true" sources:"file"`
+			Name string `required:"true"`
+		}
+	}
+
+	schema, err := Schema(&Config{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"host": {"type": "string", "description": "the host"},
+			"name": {"type": "string"},
+			"region": {"type": "string", "default": "eu"},
+			"port": {
+				"type": "integer", "default": 80, "minimum": 1, "maximum": 65535,
+				"description": "the port (PORT, default 80)"
+			},
+			"level": {"type": "string", "enum": ["debug", "info"]},
+			"ratio": {"type": "number", "default": 0.5},
+			"tags": {
+				"type": "array",
+				"items": {"type": "string", "pattern": "^[a-z]+$"},
+				"default": ["a", "b"]
+			},
+			"limit": {"type": ["string", "integer"], "default": "1MiB"},
+			"verbose": {"type": "boolean"},
+			"password": {"type": "string", "description": "the password (default )"},
+			"server": {
+				"type": "object",
+				"description": "the server",
+				"properties": {
+					"timeout": {"type": "integer", "minimum": 0, "default": 30}
+				}
+			},
+			"upstreams": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"addr": {"type": "string"},
+						"name": {"type": "string"}
+					},
+					"required": ["addr"]
+				}
+			}
+		},
+		"required": ["name"]
+	}`, string(schema))
+
+	_, err = Schema(&struct{ Map map[string]string }{})
+	assert.EqualError(t, err, "error in config structure: "+
+		"type of field Map (map[string]string) is not supported")
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import "fmt"
+
+// resolveSecret resolves the reference ref for the option if it is marked as
+// secret and a secret resolver has been configured.  Otherwise ref is
+// returned as is.
+func resolveSecret(s *setup, opt *option, ref string) (string, error) {
+	if !opt.secret || s.conf.SecretResolver == nil {
+		return ref, nil
+	}
+
+	val, err := s.conf.SecretResolver(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret value for %s: %s",
+			opt.fullID(), err)
+	}
+	return val, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Source identifies a source of config variable values.
+type Source string
+
+// The sources gonfig reads config variables from.
+const (
+	SourceFile     Source = "file"
+	SourceRegistry Source = "registry"
+	SourceMetadata Source = "metadata"
+	SourceDNS      Source = "dns"
+	SourceCustom   Source = "custom"
+	SourceDir      Source = "dir"
+	SourceEnv      Source = "env"
+	SourceFD       Source = "fd"
+	SourceFlag     Source = "flag"
+)
+
+// SourceDefault identifies default values.  It is not a source that can be
+// used in the sources tag, but it is used to tell that a default setting,
+// like Conf.FileDefaultFilename, selected the config file.
+const SourceDefault Source = "default"
+
+// allSources contains all the sources gonfig reads config variables from.
+var allSources = []Source{SourceFile, SourceRegistry, SourceMetadata, SourceDNS,
+	SourceCustom, SourceDir, SourceEnv, SourceFD, SourceFlag}
+
+// Conflict describes a config variable that has been provided by multiple
+// sources with different values.
+type Conflict struct {
+	// ID is the full ID of the config variable.
+	ID string
+
+	// Source is the source of the value that has been overridden.
+	Source Source
+	// Value is the value that has been overridden.
+	Value interface{}
+
+	// OverridingSource is the source of the value that has been used instead.
+	OverridingSource Source
+	// OverridingValue is the value that has been used instead.
+	OverridingValue interface{}
+}
+
+// trackSource records that the option has just been set by the source.  The
+// value argument is the value of the option before it was set.  If the option
+// had already been set by another source to a different value, a conflict is
+// recorded when requested in the Conf.
+func trackSource(s *setup, opt *option, source Source, value interface{}) {
+	if opt.source != "" && s.conf.Conflicts != nil {
+		newValue := opt.value.Interface()
+		if !reflect.DeepEqual(value, newValue) {
+			*s.conf.Conflicts = append(*s.conf.Conflicts, Conflict{
+				ID:               opt.fullID(),
+				Source:           opt.source,
+				Value:            value,
+				OverridingSource: source,
+				OverridingValue:  newValue,
+			})
+		}
+	}
+
+	opt.source = source
+}
+
+// checkSources checks that the sources tags of all options only contain known
+// sources, and that sensitive options can not get a value at rest.
+func checkSources(allOpts []*option) error {
+	for _, opt := range allOpts {
+		if opt.sensitive {
+			if opt.defaultSet {
+				return fmt.Errorf("default value not allowed for sensitive "+
+					"config variable %s", opt.fullID())
+			}
+			for _, source := range opt.sources {
+				if source == SourceFile {
+					return fmt.Errorf("sensitive config variable %s can not "+
+						"allow the file source", opt.fullID())
+				}
+			}
+		}
+
+		for _, source := range opt.sources {
+			known := false
+			for _, s := range allSources {
+				if source == s {
+					known = true
+					break
+				}
+			}
+			if !known {
+				return fmt.Errorf("unknown source for %s: %s", opt.fullID(), source)
+			}
+		}
+	}
+
+	return nil
+}
+
+// allowsSource returns whether the option may be set by the source.
+func (o *option) allowsSource(source Source) bool {
+	if source == SourceFlag && o.noflag || source == SourceFile && o.nofile {
+		return false
+	}
+	if len(o.sources) == 0 {
+		return true
+	}
+
+	for _, s := range o.sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceSet normalizes the value and performs the checks and bookkeeping
+// needed after the option has been set by the source.  The value argument is
+// the value of the option before it was set.
+func sourceSet(s *setup, opt *option, source Source, value interface{}) error {
+	if opt.sensitive && source == SourceFile {
+		file := "the config file"
+		if s.configFilePath != "" {
+			file = "config file " + s.configFilePath
+		}
+		return fmt.Errorf("config variable %s is sensitive and must not be "+
+			"stored in %s; provide it through another source, like an "+
+			"environment variable", opt.fullID(), file)
+	}
+	if !opt.allowsSource(source) {
+		return fmt.Errorf("config variable %s can not be set from %s",
+			opt.fullID(), source)
+	}
+
+	normalize(opt)
+
+	if err := validate(opt); err != nil {
+		err.Source = source
+		if source == SourceFile {
+			err.Origin = s.configFilePath
+		}
+		return err
+	}
+
+	warnDeprecated(s, opt, source)
+	trackSource(s, opt, source, value)
+	return nil
+}
+
+// checkRequired checks that all required options have either been provided by
+// a source or have a default value.
+func checkRequired(allOpts []*option) error {
+	for _, opt := range allOpts {
+		if opt.required && !opt.isParent && opt.source == "" && !opt.defaultSet {
+			return fmt.Errorf("%w: %s", ErrMissingRequired, opt.fullID())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// checkStrictType checks that the value val decoded from the config file has
+// the type of the option, for Conf.FileStrictTypes.  The errors do not contain
+// the values of secret options.
+func checkStrictType(opt *option, val interface{}) error {
+	secret := opt.secret
+	t := opt.value.Type()
+	if opt.isPointer {
+		t = t.Elem()
+	}
+
+	if !opt.isSlice {
+		return checkStrictValue(t, val, secret)
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		return fmt.Errorf("expected list, got %s", strictTypeName(val, secret))
+	}
+	for i, elem := range list {
+		if err := checkStrictValue(t.Elem(), elem, secret); err != nil {
+			return fmt.Errorf("element %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// checkStrictValue checks that the decoded value val can be stored in a value
+// of type t without conversion or loss of precision.
+func checkStrictValue(t reflect.Type, val interface{}, secret bool) error {
+	v := reflect.ValueOf(val)
+	_, isString := val.(string)
+
+	// Types that are parsed from text.
+	if t.Implements(typeOfTextUnmarshaler) || t == typeOfByteSlice {
+		if !isString {
+			return fmt.Errorf("expected string, got %s", strictTypeName(val, secret))
+		}
+		return nil
+	}
+	if (t == typeOfByteSize || t == typeOfDuration) && isString {
+		return nil
+	}
+
+	expected := strictKindName(t.Kind())
+	switch t.Kind() {
+	case reflect.String:
+		if isString {
+			return nil
+		}
+
+	case reflect.Bool:
+		if v.Kind() == reflect.Bool {
+			return nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if abs, neg, ok := integerValue(v); ok {
+			i := int64(abs)
+			if neg {
+				i = -i
+			}
+			if abs > math.MaxInt64 && !(neg && abs == 1<<63) ||
+				reflect.Zero(t).OverflowInt(i) {
+				return overflowError(val, t, secret)
+			}
+			return nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if abs, neg, ok := integerValue(v); ok {
+			if (neg && abs != 0) || reflect.Zero(t).OverflowUint(abs) {
+				return overflowError(val, t, secret)
+			}
+			return nil
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected %s, got %s", expected, strictTypeName(val, secret))
+}
+
+// overflowError returns the error for the value val that overflows type t.
+func overflowError(val interface{}, t reflect.Type, secret bool) error {
+	if secret {
+		return fmt.Errorf("value overflows %s", t)
+	}
+	return fmt.Errorf("value %v overflows %s", val, t)
+}
+
+// integerValue returns the absolute value and the sign of v if it is an
+// integer, or a float without fraction, like the numbers decoded from JSON.
+func integerValue(v reflect.Value) (uint64, bool, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i := v.Int(); i < 0 {
+			return uint64(-i), true, true
+		}
+		return uint64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), false, true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || math.Abs(f) >= 1<<64 {
+			return 0, false, false
+		}
+		if f < 0 {
+			return uint64(-f), true, true
+		}
+		return uint64(f), false, true
+	}
+	return 0, false, false
+}
+
+// strictKindName returns the name of the kind of value expected for values of
+// kind k in the errors for Conf.FileStrictTypes.
+func strictKindName(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// strictTypeName returns the name of the type of the decoded value val in the
+// errors for Conf.FileStrictTypes, followed by the value itself unless it is
+// secret.
+func strictTypeName(val interface{}, secret bool) string {
+	switch v := val.(type) {
+	case string:
+		if secret {
+			return "string"
+		}
+		return fmt.Sprintf("string %q", v)
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	k := reflect.ValueOf(val).Kind()
+	switch k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if secret {
+			return strictKindName(k)
+		}
+		return fmt.Sprintf("%s %v", strictKindName(k), val)
+	}
+	return fmt.Sprintf("%T", val)
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
@@ -17,6 +18,24 @@ const ( // The values for the struct field tags that we use.
 	fieldTagShort       = "short"
 	fieldTagDefault     = "default"
 	fieldTagDescription = "desc"
+	fieldTagAssert      = "assert"
+	fieldTagSecret      = "secret"
+	fieldTagOneOf       = "oneof"
+	fieldTagMetadata    = "metadata"
+	fieldTagFallback    = "fallback"
+	fieldTagRequired    = "required"
+	fieldTagAliases     = "aliases"
+	fieldTagDeprecated  = "deprecated"
+	fieldTagNormalize   = "normalize"
+	fieldTagSources     = "sources"
+	fieldTagNoFlag      = "noflag"
+	fieldTagNoFile      = "nofile"
+	fieldTagSensitive   = "sensitive"
+	fieldTagCount       = "count"
+	fieldTagGroup       = "group"
+	fieldTagMin         = "min"
+	fieldTagMax         = "max"
+	fieldTagPattern     = "pattern"
 )
 
 var ( // Some type variables for comparison.
@@ -28,6 +47,7 @@ var ( // Some type variables for comparison.
 // of the config struct.
 type option struct {
 	value   reflect.Value
+	index   int // the index of the field in the struct
 	subOpts []*option
 
 	fullIDParts  []string      // full ID of the option with all its parents
@@ -35,18 +55,110 @@ type option struct {
 	defaultValue reflect.Value // the default value
 	isParent     bool          // is nested and has children
 	isSlice      bool          // is a slice type, except for []byte
+	isPointer    bool          // is a pointer that stays nil until set
+	elemType     reflect.Type  // the struct type of the elements of a list of structs
+	elemOpts     []*option     // the options of an element of a list of structs
+	atomic       atomicValue   // the field the value is stored in, if atomic
+	source       Source        // the last source that set the value, if any
 
 	// Struct metadata specified by user.
-	id     string // the identifier
-	short  string // the shorthand to be used in CLI flags
-	defaul string // the default value
-	desc   string // the description
+	id     string   // the identifier
+	short  string   // the shorthand to be used in CLI flags
+	defaul string   // the default value
+	desc   string   // the description
+	group  string   // the group in the help message
+	assert string   // the assertion expression
+	secret bool     // contains sensitive data
+	oneof  []string // the allowed values, if restricted
+
+	normalize []string // the normalizers applied to the value
+
+	minTag     string // the minimum value, if restricted
+	maxTag     string // the maximum value, if restricted
+	patternTag string // the regular expression values must match, if any
+
+	sources []Source // the sources allowed to set the value, if restricted
+	noflag  bool     // can not be set from command line flags
+	count   bool     // the flag counts how often it is given, like -vvv
+	nofile  bool     // can not be set from the config file
+
+	sensitive bool // must not be stored at rest, like in the config file
+
+	required bool // must be provided by a source or have a default
+
+	aliases    []string // the old identifiers that are still accepted
+	deprecated string   // the deprecation message, if deprecated
+
+	metadata string // the cloud metadata key
+	fallback string // the ID of the option to fall back to when unset
+
+	fallbackOpt *option        // the resolved option to fall back to
+	min, max    *float64       // the parsed range
+	pattern     *regexp.Regexp // the compiled pattern
+
+	assertion expr // the compiled assertion expression
+}
+
+// OptionInfo describes a config variable of the config struct.
+type OptionInfo struct {
+	// ID is the full ID of the config variable, like "server.port".
+	ID string
+	// Type is the type of the struct field.
+	Type reflect.Type
+	// Description is the value of the desc tag.
+	Description string
+	// Default is the value of the default tag, if any.
+	Default string
+	// Secret is true for config variables with sensitive values.
+	Secret bool
+}
+
+// info returns the information about the option.
+func (o *option) info() OptionInfo {
+	return OptionInfo{
+		ID:          o.fullID(),
+		Type:        o.value.Type(),
+		Description: o.desc,
+		Default:     o.defaul,
+		Secret:      o.secret,
+	}
 }
 
 // fullID returns the full ID of the option consisting of all IDs of its parents
-// joined by dots.
+// joined by dots.  The indices of elements of lists of structs are not
+// preceded by a dot, like in "upstreams[2].port".
 func (o option) fullID() string {
-	return strings.Join(o.fullIDParts, ".")
+	id := o.fullIDParts[0]
+	for _, part := range o.fullIDParts[1:] {
+		if !strings.HasPrefix(part, "[") {
+			id += "."
+		}
+		id += part
+	}
+	return id
+}
+
+// optionsByID returns a map of the options by their full ID.
+func optionsByID(allOpts []*option) map[string]*option {
+	byID := make(map[string]*option, len(allOpts))
+	for _, opt := range allOpts {
+		byID[opt.fullID()] = opt
+	}
+	return byID
+}
+
+// lookupRelative looks up the option that id refers to from the option opt.
+// The id is first looked up among the siblings of opt and then as a full ID.
+func lookupRelative(byID map[string]*option, opt *option, id string) (*option, bool) {
+	if len(opt.fullIDParts) > 1 {
+		parentID := strings.Join(opt.fullIDParts[:len(opt.fullIDParts)-1], ".")
+		if sibling, ok := byID[parentID+"."+id]; ok {
+			return sibling, true
+		}
+	}
+
+	target, ok := byID[id]
+	return target, ok
 }
 
 // optionFromField creates a new option from the field information.
@@ -68,10 +180,66 @@ func optionFromField(f reflect.StructField, parent *option) *option {
 	opt.short = f.Tag.Get(fieldTagShort)
 	opt.defaul, opt.defaultSet = f.Tag.Lookup(fieldTagDefault)
 	opt.desc = f.Tag.Get(fieldTagDescription)
+	opt.group = f.Tag.Get(fieldTagGroup)
+	if opt.group == "" && parent != nil {
+		opt.group = parent.group
+	}
+	opt.assert = f.Tag.Get(fieldTagAssert)
+	opt.secret = f.Tag.Get(fieldTagSecret) == "true"
+	opt.metadata = f.Tag.Get(fieldTagMetadata)
+	opt.fallback = f.Tag.Get(fieldTagFallback)
+	opt.required = f.Tag.Get(fieldTagRequired) == "true"
+	opt.deprecated = f.Tag.Get(fieldTagDeprecated)
+	if aliases := f.Tag.Get(fieldTagAliases); aliases != "" {
+		opt.aliases = strings.Split(aliases, ",")
+	}
+	if oneof := f.Tag.Get(fieldTagOneOf); oneof != "" {
+		opt.oneof = strings.Split(oneof, ",")
+	}
+	if normalize := f.Tag.Get(fieldTagNormalize); normalize != "" {
+		opt.normalize = strings.Split(normalize, ",")
+	}
+	if sources := f.Tag.Get(fieldTagSources); sources != "" {
+		for _, source := range strings.Split(sources, ",") {
+			opt.sources = append(opt.sources, Source(source))
+		}
+	}
+	opt.noflag = f.Tag.Get(fieldTagNoFlag) == "true"
+	opt.count = f.Tag.Get(fieldTagCount) == "true"
+	opt.minTag = f.Tag.Get(fieldTagMin)
+	opt.maxTag = f.Tag.Get(fieldTagMax)
+	opt.patternTag = f.Tag.Get(fieldTagPattern)
+	opt.nofile = f.Tag.Get(fieldTagNoFile) == "true"
+	if f.Tag.Get(fieldTagSensitive) == "true" {
+		opt.sensitive = true
+		opt.secret = true
+	}
 
 	return opt
 }
 
+// checkCountTags checks that the count tag is only used for integers.
+func checkCountTags(allOpts []*option) error {
+	for _, opt := range allOpts {
+		if !opt.count {
+			continue
+		}
+
+		t := opt.value.Type()
+		if opt.isPointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		default:
+			return fmt.Errorf("count tag not supported for %s of type %s",
+				opt.fullID(), t)
+		}
+	}
+
+	return nil
+}
+
 // createOptionsFromStruct extracts all options from the struct in a
 // recursive manner.
 // It returns first a slice of all the options of the struct and second a slice
@@ -92,20 +260,42 @@ func createOptionsFromStruct(v reflect.Value, parent *option) ([]*option, []*opt
 
 		opt := optionFromField(field, parent)
 		opt.value = value
+		opt.index = f
+		if opt.desc == "" {
+			opt.desc = fieldDescription(v, field.Name)
+		}
 
-		if !isSupportedType(field.Type) {
+		fieldType := field.Type
+		if atomic, ok := atomicField(value); ok {
+			// The option writes to a detached value that is stored in the
+			// field when loading succeeds.
+			opt.atomic = atomic
+			fieldType = atomic.valueType()
+			opt.value = reflect.New(fieldType).Elem()
+			if current, ok := atomic.loadValue(); ok {
+				opt.value.Set(current)
+			}
+		}
+
+		if !isSupportedType(fieldType) {
 			return nil, nil, fmt.Errorf(
 				"type of field %s (%s) is not supported",
 				field.Name, field.Type)
 		}
 
 		var (
-			t = field.Type
-			k = field.Type.Kind()
+			t = fieldType
+			k = fieldType.Kind()
 		)
 
-		// If it is a pointer, it might be nil. Let's fill it with something.
-		if k == reflect.Ptr && opt.value.IsNil() {
+		// Pointers to simple values and slices stay nil until a value is set,
+		// so that unset values can be distinguished from zero values.
+		// Other pointers might be nil as well.  Let's fill them with something.
+		if k == reflect.Ptr && !t.Implements(typeOfTextUnmarshaler) &&
+			t.Elem().Kind() != reflect.Struct {
+			opt.isPointer = true
+			t, k = t.Elem(), t.Elem().Kind()
+		} else if k == reflect.Ptr && opt.value.IsNil() {
 			opt.value.Set(reflect.New(t.Elem()))
 		}
 
@@ -116,6 +306,14 @@ func createOptionsFromStruct(v reflect.Value, parent *option) ([]*option, []*opt
 		} else if k == reflect.Slice && t != typeOfByteSlice {
 			// All slices except []byte.
 			opt.isSlice = true
+			if structType, ok := structElemType(t); ok {
+				// The options of the elements are inspected up front.
+				opt.elemType = structType
+				opt.elemOpts, err = inspectElemStruct(opt, structType)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
 		} else if k == reflect.Struct {
 			opt.isParent = true
 			opt.subOpts, allSubOpts, err = createOptionsFromStruct(opt.value, opt)
@@ -134,37 +332,99 @@ func createOptionsFromStruct(v reflect.Value, parent *option) ([]*option, []*opt
 		allOpts = append(allOpts, append(allSubOpts, opt)...)
 	}
 
-	// Check for duplicate values for IDs inside the same struct.
+	if err := checkDuplicateIDs(opts); err != nil {
+		return nil, nil, err
+	}
+
+	return opts, allOpts, nil
+}
+
+// checkDuplicateIDs checks that the options on the same level have unique IDs
+// and aliases.
+func checkDuplicateIDs(opts []*option) error {
 	for i := range opts {
 		for j := range opts {
 			if i != j {
 				if opts[i].id == opts[j].id {
-					return nil, nil, errors.New(
+					return errors.New(
 						"duplicate config variable: " + opts[i].id)
 				}
 			}
 		}
 	}
 
-	return opts, allOpts, nil
+	// Aliases can not collide with IDs or other aliases either.
+	ids := make(map[string]bool, len(opts))
+	for _, opt := range opts {
+		ids[opt.id] = true
+	}
+	for _, opt := range opts {
+		for _, alias := range opt.aliases {
+			if ids[alias] {
+				return errors.New(
+					"duplicate config variable alias: " + alias)
+			}
+			ids[alias] = true
+		}
+	}
+
+	return nil
 }
 
-// inspectConfigStructure inspects the config struct c and inspects it while
-// building the set of options and performing sanity checks.
-func inspectConfigStructure(s *setup, c interface{}) error {
-	// First make sure that we have a pointer to a struct.
-	if reflect.TypeOf(c).Kind() != reflect.Ptr {
-		return errors.New("config variable must be a pointer to a struct")
+// inspectConfigStructure inspects the config structs cs and inspects them while
+// building the set of options and performing sanity checks.  The options of
+// multiple config structs share a single namespace.  The options of a single
+// config struct are built from a cached template for its type, see
+// cachedStructure.
+func inspectConfigStructure(s *setup, cs ...interface{}) error {
+	for _, c := range cs {
+		// First make sure that we have a pointer to a struct.
+		t := reflect.TypeOf(c)
+		if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+			return errors.New("config variable must be a pointer to a struct")
+		}
 	}
-	v := reflect.ValueOf(c).Elem()
-	t := v.Type()
-	if t.Kind() != reflect.Struct {
-		return errors.New("config variable must be a pointer to a struct")
+
+	if len(cs) == 1 {
+		return inspectCachedStructure(s, cs[0])
 	}
+	return buildConfigStructure(s, cs...)
+}
 
-	opts, allOpts, err := createOptionsFromStruct(v, nil)
-	if err != nil {
-		return err
+// buildConfigStructure does the work of inspectConfigStructure without using
+// the cache.
+func buildConfigStructure(s *setup, cs ...interface{}) error {
+	section, outer := sectionParents(s.section)
+	var opts, allOpts []*option
+	var defaulters multiDefaulter
+	for _, c := range cs {
+		v := reflect.ValueOf(c).Elem()
+
+		structOpts, structAllOpts, err := createOptionsFromStruct(v, section)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, structOpts...)
+		allOpts = append(allOpts, structAllOpts...)
+
+		if defaulter, ok := c.(Defaulter); ok {
+			defaulters = append(defaulters, defaulter)
+		}
+	}
+
+	// Options of different config structs can collide.
+	if len(cs) > 1 {
+		if err := checkDuplicateIDs(opts); err != nil {
+			return err
+		}
+	}
+
+	switch len(defaulters) {
+	case 0:
+	case 1:
+		s.defaulter = defaulters[0]
+	default:
+		s.defaulter = defaulters
 	}
 
 	// The method for getting the options from a struct already checks for
@@ -175,13 +435,75 @@ func inspectConfigStructure(s *setup, c interface{}) error {
 			if i != j {
 				if allOpts[i].short != "" && allOpts[i].short == allOpts[j].short {
 					return errors.New(
-						"duplicate config variable shorthand: " + opts[i].short)
+						"duplicate config variable shorthand: " + allOpts[i].short)
 				}
 			}
 		}
 	}
 
+	if err := compileAssertions(allOpts); err != nil {
+		return err
+	}
+
+	if err := checkMetadataKeys(allOpts); err != nil {
+		return err
+	}
+
+	if err := compileFallbacks(allOpts); err != nil {
+		return err
+	}
+
+	if err := checkNormalizers(allOpts); err != nil {
+		return err
+	}
+
+	if err := checkSources(allOpts); err != nil {
+		return err
+	}
+
+	if err := checkCountTags(allOpts); err != nil {
+		return err
+	}
+
+	if err := compileValidations(allOpts); err != nil {
+		return err
+	}
+
+	if section != nil {
+		section.subOpts = opts
+		opts = []*option{outer}
+	}
+
 	s.opts = opts
 	s.allOpts = allOpts
 	return nil
 }
+
+// sectionParents returns the innermost and the outermost of the nested
+// options for the section ID, like "server" or "services.api", of a config
+// struct loaded with LoadSection.  The innermost one is the parent of the
+// options of the config struct.  They are not part of the options of the
+// setup, as they have no value.
+func sectionParents(sectionID string) (*option, *option) {
+	if sectionID == "" {
+		return nil, nil
+	}
+
+	var inner, outer *option
+	var parts []string
+	for _, id := range strings.Split(sectionID, ".") {
+		parts = append(parts, id)
+		opt := &option{
+			id:          id,
+			fullIDParts: append(make([]string, 0, len(parts)), parts...),
+			isParent:    true,
+		}
+		if outer == nil {
+			outer = opt
+		} else {
+			inner.subOpts = []*option{opt}
+		}
+		inner = opt
+	}
+	return inner, outer
+}
@@ -5,10 +5,12 @@
 package gonfig
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOptionFromField(t *testing.T) {
@@ -85,3 +87,106 @@ func TestOptionFromField(t *testing.T) {
 		})
 	}
 }
+
+// benchStructType returns a config struct type with 100 fields of various
+// types and tags.
+func benchStructType() reflect.Type {
+	var fields []reflect.StructField
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("Field%d", i)
+		var typ reflect.Type
+		var tag string
+		switch i % 4 {
+		case 0:
+			typ = reflect.TypeOf("")
+			tag = fmt.Sprintf(`default:"value%d" desc:"string option %d" pattern:"^[a-z0-9]+$"`, i, i)
+		case 1:
+			typ = reflect.TypeOf(0)
+			tag = fmt.Sprintf(`default:"%d" desc:"int option %d" min:"0" max:"1000"`, i, i)
+		case 2:
+			typ = reflect.TypeOf(false)
+			tag = fmt.Sprintf(`desc:"bool option %d"`, i)
+		case 3:
+			typ = reflect.TypeOf([]string{})
+			tag = fmt.Sprintf(`default:"a,b,c" desc:"slice option %d" oneof:"a,b,c,d"`, i)
+		}
+		fields = append(fields, reflect.StructField{
+			Name: name,
+			Type: typ,
+			Tag:  reflect.StructTag(tag),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+func BenchmarkLoad(b *testing.B) {
+	t := benchStructType()
+	setOS(nil, nil)
+	conf := Conf{FileDisable: true, FlagDisable: true}
+
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cached=%t", cached), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !cached {
+					structureCache.Delete(structureKey{typ: reflect.PtrTo(t)})
+				}
+				c := reflect.New(t).Interface()
+				if err := Load(c, conf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInspectConfigStructure(b *testing.B) {
+	t := benchStructType()
+
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cached=%t", cached), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !cached {
+					structureCache.Delete(structureKey{typ: reflect.PtrTo(t)})
+				}
+				s := &setup{conf: &Conf{}}
+				if err := inspectConfigStructure(s, reflect.New(t).Interface()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectConfigStructure_Cached(t *testing.T) {
+	type Config struct {
+		Port    int `default:"80" assert:"port > 0"`
+		Backup  int `fallback:"port"`
+		Options *struct {
+			Name string `default:"test"`
+		}
+	}
+
+	setOS(nil, map[string]string{"PORT": "8080"})
+	var c1 Config
+	require.NoError(t, Load(&c1, Conf{FileDisable: true}))
+
+	setOS(nil, map[string]string{"PORT": "9090", "OPTIONS_NAME": "other"})
+	var c2 Config
+	require.NoError(t, Load(&c2, Conf{FileDisable: true}))
+
+	_, ok := structureCache.Load(structureKey{typ: reflect.TypeOf(&c1)})
+	assert.True(t, ok)
+
+	assert.Equal(t, 8080, c1.Port)
+	assert.Equal(t, 8080, c1.Backup)
+	assert.Equal(t, "test", c1.Options.Name)
+	assert.Equal(t, 9090, c2.Port)
+	assert.Equal(t, 9090, c2.Backup)
+	assert.Equal(t, "other", c2.Options.Name)
+
+	setOS(nil, map[string]string{"PORT": "-1"})
+	var c3 Config
+	assert.Error(t, Load(&c3, Conf{FileDisable: true}))
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"time"
+)
+
+// The phases of a load that are not a source, as used in LoadTimings.  The
+// sources after the config file are timed in a phase named after the source,
+// like "env" or "metadata".
+const (
+	PhaseInspect    = "inspect"
+	PhaseFileRead   = "file read"
+	PhaseFileDecode = "file decode"
+	PhaseValidate   = "validate"
+)
+
+// PhaseTiming holds the time spent in a phase of a load.
+type PhaseTiming struct {
+	// Phase is the name of the phase.
+	Phase string
+	// Duration is the total time spent in the phase.
+	Duration time.Duration
+}
+
+// LoadTimings is a breakdown of the time spent loading the configuration.
+type LoadTimings struct {
+	// Phases holds the timings of the phases that have been run, in order.
+	Phases []PhaseTiming
+	// Total is the total time the load took.
+	Total time.Duration
+}
+
+// timePhase adds the time since start to the phase in the load timings.
+// Phases that are run multiple times, like reading multiple config files,
+// are added up.
+func timePhase(s *setup, phase string, start time.Time) {
+	elapsed := time.Since(start)
+	for i := range s.timings.Phases {
+		if s.timings.Phases[i].Phase == phase {
+			s.timings.Phases[i].Duration += elapsed
+			return
+		}
+	}
+	s.timings.Phases = append(s.timings.Phases, PhaseTiming{phase, elapsed})
+}
+
+// finishTimings records the total time of the load, stores the timings in
+// Conf.Timings and warns when Conf.StartupBudget has been exceeded.
+func finishTimings(s *setup) {
+	s.timings.Total = time.Since(s.start)
+	if s.conf.Timings != nil {
+		*s.conf.Timings = s.timings
+	}
+
+	if s.conf.StartupBudget <= 0 || s.timings.Total <= s.conf.StartupBudget {
+		return
+	}
+
+	var slowest PhaseTiming
+	for _, phase := range s.timings.Phases {
+		if phase.Duration > slowest.Duration {
+			slowest = phase
+		}
+	}
+	warn(s, "loading the configuration took %s, exceeding the startup "+
+		"budget of %s (slowest phase: %s took %s)", s.timings.Total,
+		s.conf.StartupBudget, slowest.Phase, slowest.Duration)
+}
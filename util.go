@@ -5,6 +5,7 @@
 package gonfig
 
 import (
+	"bytes"
 	"encoding"
 	"encoding/base64"
 	"encoding/csv"
@@ -12,6 +13,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // parseInt parses s to any int type and stores it in v.
@@ -99,6 +101,24 @@ func parseSimpleValue(v reflect.Value, s string) error {
 		return nil
 	}
 
+	if t == typeOfByteSize {
+		size, err := ParseByteSize(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(size))
+		return nil
+	}
+
+	if t == typeOfDuration {
+		d, err := ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
 	if v.Type() == typeOfByteSlice {
 		decoded, err := base64.StdEncoding.DecodeString(s)
 		if err != nil {
@@ -141,6 +161,60 @@ func parseSimpleValue(v reflect.Value, s string) error {
 	return nil
 }
 
+// formatSimpleValue formats values other than structs and slices (except
+// []byte) as a string that parseSimpleValue parses back into the same value.
+func formatSimpleValue(v reflect.Value) (string, error) {
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", nil
+		}
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal value of type %s: %s",
+				v.Type(), err)
+		}
+		return string(text), nil
+	}
+
+	if v.Type() == typeOfByteSlice {
+		return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+	}
+
+	if v.Type() == typeOfDuration {
+		return time.Duration(v.Int()).String(), nil
+	}
+
+	switch v.Type().Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("can not format value of type %s", v.Type())
+}
+
+// formatSlice formats the slice as a string that parseSlice parses back into
+// the same slice.
+func formatSlice(v reflect.Value) (string, error) {
+	vals := make([]string, v.Len())
+	for i := range vals {
+		val, err := formatSimpleValue(v.Index(i))
+		if err != nil {
+			return "", err
+		}
+		vals[i] = val
+	}
+	return writeAsCSV(vals)
+}
+
 // parseSlice parses s to a slice and stores the slice in v.
 func parseSlice(v reflect.Value, s string) error {
 	vals, err := readAsCSV(s)
@@ -170,6 +244,14 @@ func convertSlice(from, to reflect.Value) error {
 			elem = elem.Elem()
 		}
 
+		if (subType == typeOfByteSize || subType == typeOfDuration) &&
+			elem.Type().Kind() == reflect.String {
+			if err := parseSimpleValue(converted.Index(i), elem.String()); err != nil {
+				return err
+			}
+			continue
+		}
+
 		if !elem.Type().ConvertibleTo(subType) {
 			return convertibleError(elem, subType)
 		}
@@ -212,6 +294,143 @@ func cleanUpYAML(v interface{}) interface{} {
 	}
 }
 
+// mergeBlocks replaces the lists of maps that HCL produces for blocks in the
+// decoded config file by a single map, merging repeated blocks, unless they
+// are the value of a list of structs in opts, for which the list is kept with
+// one element per block.  Values under keys that are not config vars, like
+// the names of config file profiles, are merged throughout.
+func mergeBlocks(s *setup, v interface{}, opts []*option) interface{} {
+	switch v := v.(type) {
+
+	case map[string]interface{}:
+		for key, val := range v {
+			opt := blockOption(s, key, opts)
+			switch {
+			case opt == nil:
+				v[key] = mergeBlocks(s, val, nil)
+			case opt.elemType != nil:
+				v[key] = blockList(s, val, opt.elemOpts)
+			default:
+				v[key] = mergeBlocks(s, val, opt.subOpts)
+			}
+		}
+		return v
+
+	case []map[string]interface{}:
+		result := make(map[string]interface{})
+		for _, m := range v {
+			for k, v := range m {
+				result[k] = v
+			}
+		}
+		return mergeBlocks(s, result, opts)
+
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = mergeBlocks(s, elem, nil)
+		}
+		return v
+
+	default:
+		return v
+	}
+}
+
+// blockList returns the list of maps that HCL produces for the blocks of a
+// list of structs as a list of the element maps.
+func blockList(s *setup, v interface{}, elemOpts []*option) interface{} {
+	var list []interface{}
+	switch v := v.(type) {
+	case []map[string]interface{}:
+		list = make([]interface{}, len(v))
+		for i, m := range v {
+			list[i] = m
+		}
+	case []interface{}:
+		list = v
+	default:
+		return mergeBlocks(s, v, nil)
+	}
+
+	for i, elem := range list {
+		list[i] = mergeBlocks(s, elem, elemOpts)
+	}
+	return list
+}
+
+// blockOption returns the option in opts for the key in a decoded config
+// file, if any, comparing normalized keys if there is a FileKeyNormalizer.
+func blockOption(s *setup, key string, opts []*option) *option {
+	normalize := func(key string) string { return key }
+	if s.conf.FileKeyNormalizer != nil {
+		normalize = s.conf.FileKeyNormalizer
+	}
+	key = normalize(key)
+	for _, opt := range opts {
+		if normalize(opt.id) == key {
+			return opt
+		}
+		for _, alias := range opt.aliases {
+			if normalize(alias) == key {
+				return opt
+			}
+		}
+	}
+	return nil
+}
+
+// expandDesc returns the description of the option with the {default}
+// placeholder replaced by its default value and the {env} placeholder by the
+// name of its environment variable.
+func expandDesc(s *setup, opt *option) string {
+	env := ""
+	if !s.conf.EnvDisable {
+		env = envKey(s.conf.EnvPrefix, opt.fullIDParts)
+	}
+
+	return strings.NewReplacer(
+		"{default}", opt.defaul,
+		"{env}", env,
+	).Replace(opt.desc)
+}
+
+// copyValue returns a deep copy of the value, so that the copy does not share
+// the elements of slices or the targets of pointers with v.
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < c.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+
+	default:
+		return v
+	}
+}
+
 // readAsCSV parses a CSV encoded list in its elements.
 func readAsCSV(val string) ([]string, error) {
 	if val == "" {
@@ -222,14 +441,14 @@ func readAsCSV(val string) ([]string, error) {
 	return csvReader.Read()
 }
 
-//// writeAsCSV writes a list of elements in a CSV encoded list.
-//func writeAsCSV(vals []string) (string, error) {
-//	b := &bytes.Buffer{}
-//	w := csv.NewWriter(b)
-//	err := w.Write(vals)
-//	if err != nil {
-//		return "", err
-//	}
-//	w.Flush()
-//	return strings.TrimSuffix(b.String(), "\n"), nil
-//}
+// writeAsCSV writes a list of elements in a CSV encoded list.
+func writeAsCSV(vals []string) (string, error) {
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+	err := w.Write(vals)
+	if err != nil {
+		return "", err
+	}
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
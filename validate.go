@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Steven Roose <steven@stevenroose.org>.
+// Use of this source code is governed by an MIT-style
+// license that can be found in the LICENSE file.
+
+package gonfig
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compileValidations parses the range and pattern tags of all options and
+// checks that they apply to the type of the option.  For slices, the tags
+// apply to the elements.
+func compileValidations(allOpts []*option) error {
+	for _, opt := range allOpts {
+		t := opt.value.Type()
+		if opt.isPointer {
+			t = t.Elem()
+		}
+		if opt.isSlice {
+			t = t.Elem()
+		}
+
+		for _, bound := range []struct {
+			tag string
+			dst **float64
+		}{{opt.minTag, &opt.min}, {opt.maxTag, &opt.max}} {
+			if bound.tag == "" {
+				continue
+			}
+			switch t.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+				reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+				reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+			default:
+				return fmt.Errorf("range for %s requires a number or a slice "+
+					"of numbers", opt.fullID())
+			}
+
+			f, err := strconv.ParseFloat(bound.tag, 64)
+			if err != nil {
+				return fmt.Errorf("invalid range for %s: %s", opt.fullID(), err)
+			}
+			*bound.dst = &f
+		}
+
+		if opt.patternTag != "" {
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("pattern for %s requires a string or a "+
+					"slice of strings", opt.fullID())
+			}
+
+			re, err := regexp.Compile(opt.patternTag)
+			if err != nil {
+				return fmt.Errorf("invalid pattern for %s: %s", opt.fullID(), err)
+			}
+			opt.pattern = re
+		}
+	}
+
+	return nil
+}
+
+// numberValue returns the value of a number as a float64.
+func numberValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// validateValue checks the value v of the option, or of one of its elements
+// for slices, and returns the reason why it is invalid, if it is.
+func validateValue(opt *option, v reflect.Value, isElem bool) string {
+	shown := fmt.Sprintf("value '%v'", v.Interface())
+	if opt.secret {
+		shown = "value"
+	}
+
+	if isElem && opt.required && reflect.DeepEqual(
+		v.Interface(), reflect.Zero(v.Type()).Interface()) {
+		return "empty element not allowed"
+	}
+
+	if len(opt.oneof) > 0 {
+		str := fmt.Sprint(v.Interface())
+		allowed := false
+		for _, choice := range opt.oneof {
+			if str == choice {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("%s must be one of [%s]",
+				shown, strings.Join(opt.oneof, ", "))
+		}
+	}
+
+	if opt.min != nil && numberValue(v) < *opt.min {
+		return fmt.Sprintf("out of range: %s is less than %v", shown, *opt.min)
+	}
+	if opt.max != nil && numberValue(v) > *opt.max {
+		return fmt.Sprintf("out of range: %s is greater than %v", shown, *opt.max)
+	}
+
+	if opt.pattern != nil && !opt.pattern.MatchString(v.String()) {
+		return fmt.Sprintf("%s does not match pattern %s", shown, opt.pattern)
+	}
+
+	return ""
+}
+
+// validate checks the value of the option against its validation tags.  For
+// slices, every element is checked and the error mentions its index.
+func validate(opt *option) *ValidationError {
+	if opt.isPointer {
+		if opt.value.IsNil() {
+			return nil
+		}
+		p := opt.pointee()
+		p.value = opt.value.Elem()
+		return validate(p)
+	}
+
+	if !opt.isSlice {
+		if reason := validateValue(opt, opt.value, false); reason != "" {
+			return &ValidationError{Option: opt.fullID(), Reason: reason}
+		}
+		return nil
+	}
+
+	for i := 0; i < opt.value.Len(); i++ {
+		if reason := validateValue(opt, opt.value.Index(i), true); reason != "" {
+			return &ValidationError{
+				Option: fmt.Sprintf("%s[%d]", opt.fullID(), i),
+				Reason: reason,
+			}
+		}
+	}
+	return nil
+}
@@ -5,23 +5,40 @@
 package gonfig
 
 import (
-	"fmt"
 	"reflect"
 )
 
+// pointee returns a copy of the pointer option for a newly allocated value of
+// the type it points to.
+func (o *option) pointee() *option {
+	p := *o
+	p.value = reflect.New(o.value.Type().Elem()).Elem()
+	p.isPointer = false
+	return &p
+}
+
+// setPointer points the pointer option to a newly allocated value that is
+// written by set.
+func (o *option) setPointer(set func(p *option) error) error {
+	p := o.pointee()
+	if err := set(p); err != nil {
+		return err
+	}
+	o.value.Set(p.value.Addr())
+	return nil
+}
+
 // setValueByString sets the value of the option by parsing the string.
 func (o *option) setValueByString(s string) error {
+	if o.isPointer {
+		return o.setPointer(func(p *option) error {
+			return p.setValueByString(s)
+		})
+	}
 	if o.isSlice {
-		if err := parseSlice(o.value, s); err != nil {
-			return fmt.Errorf("failed to set value of %s: %s", o.fullID(), err)
-		}
-	} else {
-		if err := parseSimpleValue(o.value, s); err != nil {
-			return fmt.Errorf("failed to set value of %s: %s", o.fullID(), err)
-		}
+		return parseSlice(o.value, s)
 	}
-
-	return nil
+	return parseSimpleValue(o.value, s)
 }
 
 // setValue sets the value of option to the given value.
@@ -37,6 +54,12 @@ func (o *option) setValue(v reflect.Value) error {
 		return nil
 	}
 
+	if o.isPointer {
+		return o.setPointer(func(p *option) error {
+			return p.setValue(v)
+		})
+	}
+
 	if v.Type().ConvertibleTo(t) && o.value.Type() != typeOfByteSlice {
 		o.value.Set(v.Convert(t))
 		return nil